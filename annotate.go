@@ -0,0 +1,189 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"go.uber.org/goleak/internal/stack"
+)
+
+// _ignoreDirective is a comment that marks a go statement
+// whose goroutines goleak ignores.
+// It's followed by the reason, e.g.:
+//
+//	go s.serve() //goleak:ignore runs until the process exits
+const _ignoreDirective = "//goleak:ignore"
+
+// suppressor is a filter that reports why it ignores a goroutine.
+// Reasons are listed in the leak report with [Explain].
+type suppressor func(stack.Stack) (reason string, ok bool)
+
+// suppression is a goroutine that was ignored by a suppressor.
+type suppression struct {
+	goroutine string // short description of the goroutine
+	reason    string
+}
+
+func newSuppression(s stack.Stack, reason string) suppression {
+	desc := fmt.Sprintf("goroutine %v with %v on top of the stack", s.ID(), s.FirstFunction())
+	if file, line := s.CreatedAt(); file != "" {
+		desc += fmt.Sprintf(", created at %v:%v", file, line)
+	}
+	if reason == "" {
+		reason = "no reason given"
+	}
+	return suppression{goroutine: desc, reason: reason}
+}
+
+func (s suppression) String() string {
+	return fmt.Sprintf("%v: %v", s.goroutine, s.reason)
+}
+
+// Explain lists goroutines that were ignored with a reason,
+// such as a //goleak:ignore comment, in the leak report.
+// Use this to audit why goroutines aren't reported.
+// Setting the GOLEAK_REPORT environment variable to "explain"
+// enables this for all checks, and setting it to "text" disables it.
+func Explain() Option {
+	return optionFunc(func(opts *opts) {
+		opts.explain = true
+	})
+}
+
+// isAnnotated is a default suppressor that ignores goroutines
+// started by a go statement annotated with a //goleak:ignore comment,
+// either at the end of the line or in the comment above it:
+//
+//	//goleak:ignore runs until the process exits
+//	go s.serve()
+//
+// The source file is read from the path in the stack trace,
+// so this has no effect if the source isn't available,
+// e.g. if the test binary was built with -trimpath.
+func isAnnotated(s stack.Stack) (reason string, ok bool) {
+	file, line := s.CreatedAt()
+	if file == "" {
+		return "", false
+	}
+	return ignoreDirective(_sources.lines(file), line)
+}
+
+// ignoreDirective looks for a //goleak:ignore comment
+// on the given line of a source file, numbered from 1,
+// or in the comments directly above it.
+// The directive must be at the start of the comment.
+func ignoreDirective(lines []string, line int) (reason string, ok bool) {
+	if line < 1 || line > len(lines) {
+		return "", false
+	}
+
+	if comment, ok := lineComment(lines[line-1]); ok {
+		if reason, ok := cutDirective(comment); ok {
+			return reason, true
+		}
+	}
+	for i := line - 2; i >= 0; i-- {
+		comment := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(comment, "//") {
+			break
+		}
+		if reason, ok := cutDirective(comment); ok {
+			return reason, true
+		}
+	}
+	return "", false
+}
+
+// lineComment returns the // comment at the end of a line of Go source,
+// starting with the "//".
+// Slashes in string and rune literals and in /* */ comments
+// don't start a comment.
+func lineComment(line string) (comment string, ok bool) {
+	var quote byte // quote of the current literal, if any
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++ // skip the escaped character
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case strings.HasPrefix(line[i:], "//"):
+			return line[i:], true
+		case strings.HasPrefix(line[i:], "/*"):
+			end := strings.Index(line[i+2:], "*/")
+			if end < 0 {
+				return "", false
+			}
+			i += 2 + end + 1
+		}
+	}
+	return "", false
+}
+
+// cutDirective returns the reason from a comment
+// that starts with the //goleak:ignore directive.
+func cutDirective(comment string) (reason string, ok bool) {
+	rest, ok := strings.CutPrefix(comment, _ignoreDirective)
+	if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+		// Not the directive, e.g. "//goleak:ignored".
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
+
+// _sources caches the source files read by isAnnotated.
+var _sources sourceCache
+
+// sourceCache caches the lines of source files.
+// Files are only read once, so changes while the tests run are not seen.
+type sourceCache struct {
+	mu    sync.Mutex
+	files map[string][]string // nil if the file can't be read
+}
+
+// lines returns the lines of the given file,
+// or nil if it can't be read.
+func (c *sourceCache) lines(file string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if lines, ok := c.files[file]; ok {
+		return lines
+	}
+	if c.files == nil {
+		c.files = make(map[string][]string)
+	}
+
+	var lines []string
+	if src, err := os.ReadFile(file); err == nil {
+		lines = strings.Split(string(src), "\n")
+	}
+	c.files[file] = lines
+	return lines
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func blockAnnotated(stop <-chan struct{}) {
+	<-stop
+}
+
+func TestAnnotatedGoroutines(t *testing.T) {
+	stop := make(chan struct{})
+	var done sync.WaitGroup
+	defer func() {
+		close(stop)
+		done.Wait()
+	}()
+
+	done.Add(3)
+	go func() { //goleak:ignore stopped by the test
+		defer done.Done()
+		blockAnnotated(stop)
+	}()
+
+	// The directive may be in the comments above the go statement.
+	//goleak:ignore also stopped by the test
+	go func() {
+		defer done.Done()
+		blockAnnotated(stop)
+	}()
+
+	go func() {
+		defer done.Done()
+		blockAnnotated(stop)
+	}()
+
+	var leaks []Goroutine
+	err := Find(testOptions(), OnLeak(func(gs []Goroutine) { leaks = gs }))
+	require.Error(t, err)
+	require.Len(t, leaks, 1, "only the goroutine without a directive should be reported")
+	assert.NotContains(t, err.Error(), "ignored goroutines", "requires Explain")
+
+	err = Find(testOptions(), Explain())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ignored goroutines:\n")
+	assert.Contains(t, err.Error(), "annotate_test.go")
+	assert.Contains(t, err.Error(), ": stopped by the test\n")
+	assert.Contains(t, err.Error(), ": also stopped by the test\n")
+}
+
+func TestIgnoreDirective(t *testing.T) {
+	lines := []string{
+		"func f() {",                                       // 1
+		"	go g() //goleak:ignore same line",                // 2
+		"	// Some explanation.",                            // 3
+		"	//goleak:ignore line above",                      // 4
+		"	// More explanation.",                            // 5
+		"	go g()",                                          // 6
+		"	go g() //goleak:ignored",                         // 7
+		"	go g() //goleak:ignore",                          // 8
+		"	//goleak:ignore not directly above",              // 9
+		"",                                                 // 10
+		"	go g()",                                          // 11
+		"	go g() // not ignored //goleak:ignore",           // 12
+		`	go g("//goleak:ignore in string")`,               // 13
+		`	go g("\"//") //goleak:ignore after string`,       // 14
+		"	go g('/') /* c */ //goleak:ignore after comment", // 15
+		"	go g(`//`) // not ignored",                       // 16
+		"}",                                                // 17
+	}
+
+	tests := []struct {
+		line       int
+		wantReason string
+		wantOK     bool
+	}{
+		{line: 1},
+		{line: 2, wantReason: "same line", wantOK: true},
+		{line: 6, wantReason: "line above", wantOK: true},
+		{line: 7},
+		{line: 8, wantOK: true},
+		{line: 11},
+		{line: 12},
+		{line: 13},
+		{line: 14, wantReason: "after string", wantOK: true},
+		{line: 15, wantReason: "after comment", wantOK: true},
+		{line: 16},
+		{line: 0},
+		{line: 100},
+	}
+
+	for _, tt := range tests {
+		reason, ok := ignoreDirective(lines, tt.line)
+		assert.Equal(t, tt.wantOK, ok, "line %v", tt.line)
+		assert.Equal(t, tt.wantReason, reason, "line %v", tt.line)
+	}
+}
+
+func TestSourceCache(t *testing.T) {
+	var c sourceCache
+
+	assert.Nil(t, c.lines(filepath.Join(t.TempDir(), "missing.go")))
+
+	lines := c.lines("annotate_test.go")
+	require.NotEmpty(t, lines)
+	assert.True(t, strings.HasPrefix(lines[0], "// Copyright"))
+	assert.Len(t, c.files, 2, "missing files should be cached too")
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"go.uber.org/goleak/background"
+	"go.uber.org/goleak/internal/stack"
+)
+
+// RegisterBackground registers goroutines that a library intentionally
+// keeps running in the background, e.g. a cache's janitor,
+// so that the users of the library don't have to ignore them.
+// Goroutines that match the given Matcher are ignored by
+// [Find], [VerifyNone], and [VerifyTestMain],
+// and the reason is listed in the leak report with [Explain].
+//
+// It's meant to be called from the library's init function:
+//
+//	func init() {
+//		goleak.RegisterBackground(
+//			goleak.TopFunction("example.com/cache.(*Cache).janitor"),
+//			"removes expired entries until the process exits",
+//		)
+//	}
+//
+// Libraries that don't otherwise import goleak should use
+// [background.Register] instead, which has no dependencies.
+func RegisterBackground(m Matcher, reason string) {
+	background.Register(func(g background.Goroutine) bool {
+		gg, ok := g.(Goroutine)
+		return ok && m(gg)
+	}, reason)
+}
+
+// isRegisteredBackground is a default suppressor that ignores
+// goroutines registered with RegisterBackground or [background.Register].
+func isRegisteredBackground(s stack.Stack) (reason string, ok bool) {
+	return background.Match(Goroutine{s: s})
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package background lets libraries register goroutines that they
+// intentionally keep running in the background, e.g. a cache's janitor,
+// so that goleak doesn't report them as leaks in their users' tests.
+//
+// It has no dependencies, so libraries can register goroutines
+// from production code without importing goleak:
+//
+//	func init() {
+//		background.Register(func(g background.Goroutine) bool {
+//			return g.TopFunction() == "example.com/cache.(*Cache).janitor"
+//		}, "removes expired entries until the process exits")
+//	}
+//
+// Goroutines that match a registered matcher are ignored by
+// goleak.Find, goleak.VerifyNone, and goleak.VerifyTestMain.
+package background // import "go.uber.org/goleak/background"
+
+import "sync"
+
+// Goroutine is a goroutine that a Matcher is called with.
+// It's implemented by goleak.Goroutine.
+type Goroutine interface {
+	// ID returns the goroutine's ID.
+	ID() int
+
+	// State returns the goroutine's state, e.g. "chan receive".
+	State() string
+
+	// TopFunction returns the fully qualified name of the function
+	// at the top of the goroutine's stack.
+	TopFunction() string
+
+	// CreatedBy returns the fully qualified name of the function
+	// that started the goroutine, if known.
+	CreatedBy() string
+
+	// HasFunction reports whether the function with the given
+	// fully qualified name is anywhere in the goroutine's stack.
+	HasFunction(name string) bool
+}
+
+// Matcher reports whether a goroutine is a background goroutine.
+type Matcher func(Goroutine) bool
+
+// _registry holds the registered matchers.
+var _registry registry
+
+// Register registers goroutines that match m as background goroutines,
+// with the reason they're running.
+// The reason is listed in goleak's leak report with goleak.Explain.
+//
+// Registering only records the matcher,
+// so it's cheap to call from production code.
+func Register(m Matcher, reason string) {
+	_registry.register(m, reason)
+}
+
+// Match returns the reason of the first registered matcher
+// that matches the given goroutine.
+func Match(g Goroutine) (reason string, ok bool) {
+	return _registry.match(g)
+}
+
+// registry is a list of matchers for background goroutines,
+// with the reasons they're running.
+type registry struct {
+	mu      sync.RWMutex
+	entries []entry
+}
+
+type entry struct {
+	match  Matcher
+	reason string
+}
+
+func (r *registry) register(m Matcher, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry{match: m, reason: reason})
+}
+
+func (r *registry) match(g Goroutine) (reason string, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, e := range r.entries {
+		if e.match(g) {
+			return e.reason, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package background
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeGoroutine struct {
+	Goroutine
+
+	id int
+}
+
+func (g fakeGoroutine) ID() int { return g.id }
+
+func TestRegistry(t *testing.T) {
+	var r registry
+	_, ok := r.match(fakeGoroutine{id: 1})
+	assert.False(t, ok, "empty registry")
+
+	r.register(func(Goroutine) bool { return false }, "never")
+	r.register(func(g Goroutine) bool { return g.ID() == 1 }, "first")
+	r.register(func(Goroutine) bool { return true }, "second")
+
+	reason, ok := r.match(fakeGoroutine{id: 1})
+	assert.True(t, ok)
+	assert.Equal(t, "first", reason)
+
+	reason, ok = r.match(fakeGoroutine{id: 2})
+	assert.True(t, ok)
+	assert.Equal(t, "second", reason)
+}
+
+func TestRegister(t *testing.T) {
+	defer func(entries []entry) {
+		_registry.entries = entries
+	}(_registry.entries)
+
+	_, ok := Match(fakeGoroutine{id: 1})
+	assert.False(t, ok)
+
+	Register(func(g Goroutine) bool { return g.ID() == 1 }, "registered")
+	reason, ok := Match(fakeGoroutine{id: 1})
+	assert.True(t, ok)
+	assert.Equal(t, "registered", reason)
+}
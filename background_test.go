@@ -0,0 +1,80 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/background"
+)
+
+// untilCleanup returns a flag that's set until the test ends.
+// Registered matchers can't be removed,
+// so tests use it to stop them from matching goroutines in other tests.
+func untilCleanup(t *testing.T) *atomic.Bool {
+	var active atomic.Bool
+	active.Store(true)
+	t.Cleanup(func() { active.Store(false) })
+	return &active
+}
+
+func TestRegisterBackground(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	require.Error(t, Find(testOptions()), "not registered yet")
+
+	active := untilCleanup(t)
+	RegisterBackground(func(g Goroutine) bool {
+		return active.Load() && g.ID() == bg.id
+	}, "blocks until the test ends")
+	assert.NoError(t, Find(testOptions()))
+
+	other := startBlockedG()
+	defer other.unblock()
+
+	var leaks []Goroutine
+	err := Find(testOptions(), Explain(), OnLeak(func(gs []Goroutine) { leaks = gs }))
+	require.Error(t, err)
+	require.Len(t, leaks, 1)
+	assert.Equal(t, other.id, leaks[0].ID())
+	assert.Contains(t, err.Error(), "ignored goroutines:\n")
+	assert.Contains(t, err.Error(), ": blocks until the test ends\n")
+}
+
+func TestBackgroundRegister(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	active := untilCleanup(t)
+	background.Register(func(g background.Goroutine) bool {
+		return active.Load() && g.ID() == bg.id &&
+			g.TopFunction() == "go.uber.org/goleak.(*blockedG).block"
+	}, "registered without goleak")
+
+	var leaks []Goroutine
+	err := Find(testOptions(), Explain(), OnLeak(func(gs []Goroutine) { leaks = gs }))
+	require.NoError(t, err)
+	assert.Empty(t, leaks)
+}
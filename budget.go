@@ -0,0 +1,90 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"fmt"
+
+	"go.uber.org/goleak/internal/stack"
+)
+
+// budget tolerates up to max goroutines that match a Matcher.
+type budget struct {
+	match Matcher
+	max   int
+}
+
+// AllowUpTo tolerates up to n goroutines that match the given Matcher.
+// If more than n goroutines match, all of them are reported as leaks,
+// even if another AllowUpTo would tolerate some of them.
+//
+// Use this for libraries that start a bounded number of long-lived
+// goroutines that cannot be shut down, e.g.,
+//
+//	goleak.AllowUpTo(goleak.CreatedBy("example.com/lib.(*Pool).start"), 4)
+//
+// Unlike ignoring the library entirely with [IgnoreAnyFunction],
+// this still catches unbounded growth, such as a goroutine per request.
+func AllowUpTo(m Matcher, n int) Option {
+	return optionFunc(func(opts *opts) {
+		opts.budgets = append(opts.budgets, budget{match: m, max: n})
+	})
+}
+
+// applyBudgets removes goroutines that are within the budgets of opts.
+// It returns the remaining goroutines, and a description of each budget
+// that was exceeded. Goroutines that match an exceeded budget always remain.
+// applyBudgets modifies the passed in stacks slice.
+func applyBudgets(stacks []stack.Stack, opts *opts) (_ []stack.Stack, exceeded []string) {
+	if len(opts.budgets) == 0 {
+		return stacks, nil
+	}
+
+	allowed := make([]bool, len(stacks))
+	over := make([]bool, len(stacks))
+	for i, b := range opts.budgets {
+		var matched []int
+		for j, s := range stacks {
+			if b.match(Goroutine{s: s}) {
+				matched = append(matched, j)
+			}
+		}
+		if len(matched) > 0 && len(matched) > b.max {
+			exceeded = append(exceeded, fmt.Sprintf(
+				"AllowUpTo #%d: %d matching goroutines, allowed up to %d", i+1, len(matched), b.max))
+			for _, j := range matched {
+				over[j] = true
+			}
+			continue
+		}
+		for _, j := range matched {
+			allowed[j] = true
+		}
+	}
+
+	remaining := stacks[:0]
+	for i, s := range stacks {
+		if over[i] || !allowed[i] {
+			remaining = append(remaining, s)
+		}
+	}
+	return remaining, exceeded
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowUpTo(t *testing.T) {
+	blocked := CreatedBy("go.uber.org/goleak.startBlockedG")
+
+	bg1 := startBlockedG()
+	defer bg1.unblock()
+	bg2 := startBlockedG()
+	defer bg2.unblock()
+
+	t.Run("within budget", func(t *testing.T) {
+		require.NoError(t, Find(testOptions(), AllowUpTo(blocked, 2)))
+	})
+
+	t.Run("budget exceeded", func(t *testing.T) {
+		err := Find(testOptions(), AllowUpTo(blocked, 1))
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "AllowUpTo #1: 2 matching goroutines, allowed up to 1")
+	})
+
+	t.Run("unrelated goroutines", func(t *testing.T) {
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			<-stop
+		}()
+		defer func() {
+			close(stop)
+			<-done
+		}()
+
+		var leaks []Goroutine
+		err := Find(testOptions(), AllowUpTo(blocked, 2), OnLeak(func(gs []Goroutine) {
+			leaks = gs
+		}))
+		require.Error(t, err)
+		assert.NotContains(t, err.Error(), "allowed up to")
+		require.Len(t, leaks, 1, "Goroutines within budget should not be reported")
+		assert.NotEqual(t, "go.uber.org/goleak.startBlockedG", leaks[0].CreatedBy())
+	})
+
+	t.Run("multiple budgets", func(t *testing.T) {
+		var leaks []Goroutine
+		err := Find(testOptions(),
+			AllowUpTo(blocked, 0),
+			AllowUpTo(TopFunction("go.uber.org/goleak.(*blockedG).block"), 2),
+			OnLeak(func(gs []Goroutine) { leaks = gs }),
+		)
+		require.Error(t, err, "An exceeded budget is reported even if another budget allows it")
+		assert.ErrorContains(t, err, "AllowUpTo #1: 2 matching goroutines, allowed up to 0")
+		assert.NotContains(t, err.Error(), "AllowUpTo #2")
+		assert.Len(t, leaks, 2)
+	})
+
+	t.Run("negative budget without matches", func(t *testing.T) {
+		err := Find(testOptions(),
+			AllowUpTo(blocked, 1),
+			AllowUpTo(CreatedBy("example.com/unused.start"), -1),
+		)
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "AllowUpTo #1")
+		assert.NotContains(t, err.Error(), "AllowUpTo #2", "Budgets without goroutines are not reported")
+	})
+}
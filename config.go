@@ -0,0 +1,251 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// _configFile is the name of the config file that ConfigFile looks for.
+const _configFile = ".goleak.json"
+
+// _unsupportedConfigFiles are config files in formats that goleak doesn't
+// read. ConfigFile fails if it finds one of them, rather than ignoring it.
+var _unsupportedConfigFiles = []string{".goleak.yaml", ".goleak.yml"}
+
+// _config is the config file for the package under test, if any.
+var _config = new(configLoader)
+
+// ConfigFile applies the options in the .goleak.json file
+// of the package under test, so that packages can share them.
+// goleak looks for the file in the working directory,
+// which is the package directory for tests,
+// and in its parent directories up to the module root,
+// which is the first directory with a go.mod file.
+// The file is read once, when it's first needed.
+// If it can't be read or is invalid, checks fail with an error.
+//
+// Only JSON is supported, so that goleak has no dependencies
+// beyond the standard library; a .goleak.yaml file is an error.
+// The file is only read if ConfigFile is passed, so that a file
+// in the working directory can't change the behavior of
+// checks in production code, such as [Scope].
+//
+// The options are applied in place of ConfigFile,
+// so pass it first to have the options after it
+// override its settings and add to its ignores:
+//
+//	goleak.VerifyTestMain(m, goleak.ConfigFile(), goleak.IgnoreCurrent())
+//
+// A config file looks like:
+//
+//	{
+//	  "ignore": {
+//	    "topFunctions": ["example.com/foo.worker"],
+//	    "anyFunctions": ["example.com/bar.(*Pool).run"],
+//	    "createdBy": ["example.com/baz.Start"],
+//	    "createdAt": ["baz/start.go:42"],
+//	    "createdInFiles": ["*.pb.go"],
+//	    "presets": ["net/http"]
+//	  },
+//	  "onlyInvolving": ["example.com/..."],
+//	  "timeout": "5s",
+//	  "settleAfter": 3,
+//	  "report": "explain",
+//	  "warnOnly": true
+//	}
+//
+// All fields are optional. Each one sets the matching option,
+// e.g., "createdInFiles" patterns are passed to [IgnoreCreatedInFile],
+// and "report" is "text" or "explain" (see [Explain]).
+func ConfigFile() Option {
+	return optionFunc(func(opts *opts) {
+		opt, err := _config.load()
+		if err != nil {
+			opts.configErr = err
+		} else if opt != nil {
+			opt.apply(opts)
+		}
+	})
+}
+
+// configLoader loads the config file once.
+type configLoader struct {
+	once sync.Once
+	opt  Option // nil if there's no config file
+	err  error
+}
+
+func (l *configLoader) load() (Option, error) {
+	l.once.Do(func() {
+		dir, err := os.Getwd()
+		if err != nil {
+			l.err = fmt.Errorf("goleak: look for config file: %w", err)
+			return
+		}
+		l.opt, l.err = loadConfig(dir)
+	})
+	return l.opt, l.err
+}
+
+// fileConfig is the contents of a config file.
+type fileConfig struct {
+	Ignore        ignoreConfig `json:"ignore"`
+	OnlyInvolving []string     `json:"onlyInvolving"`
+	Timeout       string       `json:"timeout"`
+	SettleAfter   int          `json:"settleAfter"`
+	Report        string       `json:"report"`
+	WarnOnly      bool         `json:"warnOnly"`
+}
+
+type ignoreConfig struct {
+	TopFunctions   []string `json:"topFunctions"`
+	AnyFunctions   []string `json:"anyFunctions"`
+	CreatedBy      []string `json:"createdBy"`
+	CreatedAt      []string `json:"createdAt"`
+	CreatedInFiles []string `json:"createdInFiles"`
+	Presets        []string `json:"presets"`
+}
+
+// loadConfig loads the config file for the given directory,
+// and returns its options, or nil if there's no config file.
+func loadConfig(dir string) (Option, error) {
+	path := findConfig(dir)
+	if path == "" {
+		return nil, nil
+	}
+	if filepath.Base(path) != _configFile {
+		return nil, fmt.Errorf("goleak: config file %v: only JSON is supported, use %v", path, _configFile)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("goleak: read config file: %w", err)
+	}
+	cfg, err := parseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("goleak: parse config file %v: %w", path, err)
+	}
+	opt, err := cfg.options()
+	if err != nil {
+		return nil, fmt.Errorf("goleak: config file %v: %w", path, err)
+	}
+	return opt, nil
+}
+
+// findConfig returns the path of the config file for the given directory,
+// or an empty string if there's none.
+// It looks in the directory and its parents up to the module root.
+// The path may be one of _unsupportedConfigFiles.
+func findConfig(dir string) string {
+	names := append([]string{_configFile}, _unsupportedConfigFiles...)
+	for {
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return "" // module root
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// parseConfig parses the JSON contents of a config file.
+// Unknown fields are an error, to catch typos.
+func parseConfig(data []byte) (*fileConfig, error) {
+	var cfg fileConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		if errors.Is(err, io.EOF) {
+			// The file is empty.
+			return &cfg, nil
+		}
+		return nil, err
+	}
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return nil, errors.New("unexpected data after the top-level object")
+	}
+	return &cfg, nil
+}
+
+// options returns the options set by the config.
+func (c *fileConfig) options() (Option, error) {
+	var options []Option
+	for _, f := range c.Ignore.TopFunctions {
+		options = append(options, IgnoreTopFunction(f))
+	}
+	for _, f := range c.Ignore.AnyFunctions {
+		options = append(options, IgnoreAnyFunction(f))
+	}
+	for _, f := range c.Ignore.CreatedBy {
+		options = append(options, IgnoreCreatedBy(f))
+	}
+	for _, loc := range c.Ignore.CreatedAt {
+		options = append(options, IgnoreCreatedAt(loc))
+	}
+	for _, pattern := range c.Ignore.CreatedInFiles {
+		options = append(options, IgnoreCreatedInFile(pattern))
+	}
+	if len(c.Ignore.Presets) > 0 {
+		options = append(options, IgnorePreset(c.Ignore.Presets...))
+	}
+	if len(c.OnlyInvolving) > 0 {
+		options = append(options, OnlyInvolving(c.OnlyInvolving...))
+	}
+	if c.Timeout != "" {
+		d, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("bad timeout: %w", err)
+		}
+		options = append(options, Timeout(d))
+	}
+	if c.SettleAfter != 0 {
+		options = append(options, SettleAfter(c.SettleAfter))
+	}
+	switch c.Report {
+	case "", "text":
+	case "explain":
+		options = append(options, Explain())
+	default:
+		return nil, fmt.Errorf(`unknown report format %q, must be "text" or "explain"`, c.Report)
+	}
+	if c.WarnOnly {
+		options = append(options, WarnOnly())
+	}
+	return Options(options...), nil
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setConfig makes checks use the given config file options and error
+// until the end of the test.
+func setConfig(t *testing.T, opt Option, err error) {
+	l := &configLoader{opt: opt, err: err}
+	l.once.Do(func() {})
+
+	prev := _config
+	_config = l
+	t.Cleanup(func() { _config = prev })
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+}
+
+func TestFindConfig(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "mod", "go.mod"), "module example.com/mod\n")
+	writeFile(t, filepath.Join(root, "mod", ".goleak.json"), "{}")
+	writeFile(t, filepath.Join(root, "mod", "a", ".goleak.json"), "{}")
+	writeFile(t, filepath.Join(root, "mod", "yaml", ".goleak.yaml"), "")
+	writeFile(t, filepath.Join(root, ".goleak.json"), "{}")
+	writeFile(t, filepath.Join(root, "other", "go.mod"), "module example.com/other\n")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "mod", "a", "b"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "mod", "c"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "other", "pkg"), 0o755))
+
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{dir: "mod", want: "mod/.goleak.json"},
+		{dir: "mod/c", want: "mod/.goleak.json"},
+		{dir: "mod/a/b", want: "mod/a/.goleak.json"},
+		{dir: "mod/yaml", want: "mod/yaml/.goleak.yaml"}, // reported as unsupported
+		{dir: "other/pkg", want: ""},                     // stops at the module root
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			got := findConfig(filepath.Join(root, filepath.FromSlash(tt.dir)))
+			if tt.want == "" {
+				assert.Empty(t, got)
+			} else {
+				assert.Equal(t, filepath.Join(root, filepath.FromSlash(tt.want)), got)
+			}
+		})
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	want := &fileConfig{
+		Ignore: ignoreConfig{
+			TopFunctions:   []string{"example.com/foo.top"},
+			AnyFunctions:   []string{"example.com/foo.any"},
+			CreatedBy:      []string{"example.com/foo.creator"},
+			CreatedAt:      []string{"foo/bar.go:42"},
+			CreatedInFiles: []string{"*.pb.go"},
+			Presets:        []string{"net/http"},
+		},
+		OnlyInvolving: []string{"example.com/..."},
+		Timeout:       "5s",
+		SettleAfter:   3,
+		Report:        "explain",
+		WarnOnly:      true,
+	}
+
+	t.Run("json", func(t *testing.T) {
+		got, err := parseConfig([]byte(`{
+			"ignore": {
+				"topFunctions": ["example.com/foo.top"],
+				"anyFunctions": ["example.com/foo.any"],
+				"createdBy": ["example.com/foo.creator"],
+				"createdAt": ["foo/bar.go:42"],
+				"createdInFiles": ["*.pb.go"],
+				"presets": ["net/http"]
+			},
+			"onlyInvolving": ["example.com/..."],
+			"timeout": "5s",
+			"settleAfter": 3,
+			"report": "explain",
+			"warnOnly": true
+		}`))
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		got, err := parseConfig(nil)
+		require.NoError(t, err)
+		assert.Equal(t, &fileConfig{}, got)
+	})
+
+	t.Run("unknown fields", func(t *testing.T) {
+		_, err := parseConfig([]byte(`{"ignores": {}}`))
+		assert.ErrorContains(t, err, "ignores")
+
+		_, err = parseConfig([]byte(`{"ignore": {"topFunction": ["foo.bar"]}}`))
+		assert.ErrorContains(t, err, "topFunction")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := parseConfig([]byte("timeout: 5s\n"))
+		assert.Error(t, err, "YAML is not supported")
+	})
+
+	t.Run("trailing data", func(t *testing.T) {
+		_, err := parseConfig([]byte(`{"timeout": "5s"} {"bogus": 1}`))
+		assert.ErrorContains(t, err, "unexpected data")
+
+		_, err = parseConfig([]byte(`{"timeout": "5s"}}`))
+		assert.ErrorContains(t, err, "unexpected data")
+
+		_, err = parseConfig([]byte("{\"timeout\": \"5s\"}\n\n"))
+		assert.NoError(t, err, "trailing whitespace is allowed")
+	})
+}
+
+func TestConfigOptions(t *testing.T) {
+	cfg := &fileConfig{
+		Ignore: ignoreConfig{
+			TopFunctions: []string{"example.com/foo.top"},
+			Presets:      []string{"example.com/unknown"},
+		},
+		OnlyInvolving: []string{"example.com/..."},
+		Timeout:       "5s",
+		SettleAfter:   3,
+		Report:        "explain",
+		WarnOnly:      true,
+	}
+	opt, err := cfg.options()
+	require.NoError(t, err)
+
+	var opts opts
+	opt.apply(&opts)
+	assert.Len(t, opts.filters, 1)
+	assert.Equal(t, []string{"example.com/unknown"}, opts.unknownPresets)
+	assert.Equal(t, []string{"example.com"}, opts.involving)
+	assert.Equal(t, 5*time.Second, opts.timeout)
+	assert.Equal(t, 3, opts.settleAfter)
+	assert.True(t, opts.explain)
+	assert.True(t, opts.warnOnly)
+
+	_, err = (&fileConfig{Timeout: "5"}).options()
+	assert.ErrorContains(t, err, "bad timeout")
+
+	_, err = (&fileConfig{Report: "html"}).options()
+	assert.ErrorContains(t, err, `unknown report format "html"`)
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/mod\n")
+
+	opt, err := loadConfig(dir)
+	require.NoError(t, err)
+	assert.Nil(t, opt, "no config file")
+
+	path := filepath.Join(dir, ".goleak.json")
+	writeFile(t, path, `{"timeout": "2s"}`)
+	opt, err = loadConfig(dir)
+	require.NoError(t, err)
+	var opts opts
+	opt.apply(&opts)
+	assert.Equal(t, 2*time.Second, opts.timeout)
+
+	writeFile(t, path, `{"timeout": ["2s"]}`)
+	_, err = loadConfig(dir)
+	assert.ErrorContains(t, err, "parse config file "+path)
+
+	writeFile(t, path, `{"report": "html"}`)
+	_, err = loadConfig(dir)
+	assert.ErrorContains(t, err, "config file "+path)
+
+	yamlDir := filepath.Join(dir, "yaml")
+	writeFile(t, filepath.Join(yamlDir, ".goleak.yaml"), "timeout: 2s\n")
+	_, err = loadConfig(yamlDir)
+	assert.ErrorContains(t, err, "only JSON is supported")
+}
+
+func TestConfigFile(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	t.Run("options", func(t *testing.T) {
+		setConfig(t, IgnoreTopFunction("go.uber.org/goleak.(*blockedG).block"), nil)
+		assert.NoError(t, Find(ConfigFile(), testOptions()))
+		assert.Error(t, Find(testOptions()), "config file should only be used with ConfigFile")
+	})
+
+	t.Run("no config file", func(t *testing.T) {
+		setConfig(t, nil, nil)
+		assert.Error(t, Find(ConfigFile(), testOptions()))
+	})
+
+	t.Run("overridden", func(t *testing.T) {
+		setConfig(t, WarnOnly(), nil)
+		var warned bool
+		opts := buildOpts(ConfigFile(), testOptions(), optionFunc(func(opts *opts) {
+			opts.warnOnly = false
+			opts.log = func(string) { warned = true }
+		}))
+		assert.Error(t, Find(opts), "options after ConfigFile override it")
+		assert.False(t, warned)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		setConfig(t, nil, errors.New("great sadness"))
+		assert.EqualError(t, Find(ConfigFile(), testOptions()), "great sadness")
+
+		_, err := Scope(func() {}, ConfigFile(), testOptions())
+		assert.EqualError(t, err, "great sadness")
+
+		err = Find(testOptions())
+		assert.NotContains(t, err.Error(), "great sadness", "config file should only be used with ConfigFile")
+	})
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Environment variables that change goleak's behavior for a run
+// without editing code. They override the options passed in code
+// and in config files.
+const (
+	// _disableEnv, if set to true, turns Find, VerifyNone,
+	// and VerifyTestMain into no-ops, e.g. while bisecting
+	// unrelated test failures.
+	_disableEnv = "GOLEAK_DISABLE"
+
+	// _runOnFailureEnv, if set to true, enables RunOnFailure
+	// for VerifyTestMain, and setting it to false disables it.
+	// It has no effect on other checks, which can't take RunOnFailure.
+	_runOnFailureEnv = "GOLEAK_RUN_ON_FAILURE"
+
+	// _timeoutEnv sets the Timeout for all checks, e.g. "10s".
+	_timeoutEnv = "GOLEAK_TIMEOUT"
+
+	// _reportEnv sets the format of leak reports:
+	// "text" for the default format, or "explain" for Explain.
+	_reportEnv = "GOLEAK_REPORT"
+
+	// _warnOnlyEnv, if set to true, enables WarnOnly for all checks,
+	// and setting it to false disables it.
+	_warnOnlyEnv = "GOLEAK_WARN_ONLY"
+)
+
+// applyEnv applies the environment variables above to opts,
+// other than GOLEAK_RUN_ON_FAILURE, which only VerifyTestMain reads.
+// Invalid values make checks fail with an error.
+func applyEnv(opts *opts) {
+	var errs []error
+	if v, ok, err := lookupBoolEnv(_disableEnv); err != nil {
+		errs = append(errs, err)
+	} else if ok {
+		opts.disabled = v
+	}
+
+	if v, ok := os.LookupEnv(_timeoutEnv); ok {
+		if d, err := time.ParseDuration(v); err != nil {
+			errs = append(errs, envError(_timeoutEnv, v, err))
+		} else {
+			opts.timeout = d
+		}
+	}
+
+	if v, ok := os.LookupEnv(_reportEnv); ok {
+		switch v {
+		case "text":
+			opts.explain = false
+		case "explain":
+			opts.explain = true
+		default:
+			errs = append(errs, envError(_reportEnv, v, errors.New(`must be "text" or "explain"`)))
+		}
+	}
+
+	if v, ok, err := lookupBoolEnv(_warnOnlyEnv); err != nil {
+		errs = append(errs, err)
+	} else if ok {
+		opts.warnOnly = v
+	}
+
+	opts.envErr = errors.Join(errs...)
+}
+
+// lookupBoolEnv looks up an environment variable that holds a boolean,
+// as accepted by strconv.ParseBool.
+func lookupBoolEnv(name string) (value, ok bool, err error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return false, false, nil
+	}
+	value, err = strconv.ParseBool(v)
+	if err != nil {
+		return false, false, envError(name, v, errors.New("must be true or false"))
+	}
+	return value, true, nil
+}
+
+func envError(name, value string, err error) error {
+	return fmt.Errorf("goleak: bad value %q for %v: %w", value, name, err)
+}
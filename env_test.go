@@ -0,0 +1,172 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		opts    []Option
+		check   func(*testing.T, *opts)
+		wantErr []string
+	}{
+		{
+			name: "unset",
+			opts: []Option{Timeout(time.Second), Explain(), WarnOnly()},
+			check: func(t *testing.T, opts *opts) {
+				assert.False(t, opts.disabled)
+				assert.Equal(t, time.Second, opts.timeout)
+				assert.True(t, opts.explain)
+				assert.True(t, opts.warnOnly)
+			},
+		},
+		{
+			name: "override",
+			env: map[string]string{
+				"GOLEAK_DISABLE":   "true",
+				"GOLEAK_TIMEOUT":   "3s",
+				"GOLEAK_REPORT":    "text",
+				"GOLEAK_WARN_ONLY": "false",
+			},
+			opts: []Option{Timeout(time.Second), Explain(), WarnOnly()},
+			check: func(t *testing.T, opts *opts) {
+				assert.True(t, opts.disabled)
+				assert.Equal(t, 3*time.Second, opts.timeout)
+				assert.False(t, opts.explain)
+				assert.False(t, opts.warnOnly)
+			},
+		},
+		{
+			name: "enable",
+			env: map[string]string{
+				"GOLEAK_DISABLE":   "0",
+				"GOLEAK_REPORT":    "explain",
+				"GOLEAK_WARN_ONLY": "1",
+			},
+			check: func(t *testing.T, opts *opts) {
+				assert.False(t, opts.disabled)
+				assert.True(t, opts.explain)
+				assert.True(t, opts.warnOnly)
+			},
+		},
+		{
+			name: "run on failure ignored",
+			env:  map[string]string{"GOLEAK_RUN_ON_FAILURE": "true"},
+			check: func(t *testing.T, opts *opts) {
+				assert.False(t, opts.runOnFailure, "only VerifyTestMain reads GOLEAK_RUN_ON_FAILURE")
+			},
+		},
+		{
+			name: "invalid",
+			env: map[string]string{
+				"GOLEAK_DISABLE":   "yes",
+				"GOLEAK_TIMEOUT":   "3",
+				"GOLEAK_REPORT":    "json",
+				"GOLEAK_WARN_ONLY": "maybe",
+			},
+			opts: []Option{Timeout(time.Second)},
+			check: func(t *testing.T, opts *opts) {
+				assert.Equal(t, time.Second, opts.timeout, "invalid values are not applied")
+			},
+			wantErr: []string{
+				`bad value "yes" for GOLEAK_DISABLE`,
+				`bad value "3" for GOLEAK_TIMEOUT`,
+				`bad value "json" for GOLEAK_REPORT: must be "text" or "explain"`,
+				`bad value "maybe" for GOLEAK_WARN_ONLY: must be true or false`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			opts := buildOpts(tt.opts...)
+			tt.check(t, opts)
+
+			err := opts.err()
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			for _, want := range tt.wantErr {
+				assert.Contains(t, err.Error(), want)
+			}
+		})
+	}
+}
+
+func TestDisableEnv(t *testing.T) {
+	t.Setenv("GOLEAK_DISABLE", "true")
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	assert.NoError(t, Find(testOptions()))
+
+	ft := &fakeT{}
+	VerifyNone(ft, testOptions())
+	assert.Empty(t, ft.errors)
+
+	defer clearOSStubs()
+	exitCode, stderr := osStubs()
+	VerifyTestMain(dummyTestMain(0), testOptions())
+	assert.Equal(t, 0, <-exitCode)
+	assert.Empty(t, <-stderr)
+}
+
+func TestRunOnFailureEnv(t *testing.T) {
+	defer clearOSStubs()
+	exitCode, stderr := osStubs()
+
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	t.Run("enables", func(t *testing.T) {
+		t.Setenv("GOLEAK_RUN_ON_FAILURE", "true")
+		VerifyTestMain(dummyTestMain(7), testOptions())
+		assert.Equal(t, 7, <-exitCode)
+		assert.Contains(t, <-stderr, "goleak: Errors on unsuccessful test run")
+	})
+
+	t.Run("disables", func(t *testing.T) {
+		t.Setenv("GOLEAK_RUN_ON_FAILURE", "false")
+		VerifyTestMain(dummyTestMain(7), testOptions(), RunOnFailure())
+		assert.Equal(t, 7, <-exitCode)
+		assert.Empty(t, <-stderr)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Setenv("GOLEAK_RUN_ON_FAILURE", "sometimes")
+		VerifyTestMain(dummyTestMain(0), testOptions())
+		assert.Equal(t, 1, <-exitCode)
+		assert.Contains(t, <-stderr, `bad value "sometimes" for GOLEAK_RUN_ON_FAILURE`)
+	})
+}
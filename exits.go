@@ -0,0 +1,68 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"time"
+
+	"go.uber.org/goleak/internal/stack"
+)
+
+// slowExit is a goroutine that was unexpected in the first sample
+// and exited during a later one.
+type slowExit struct {
+	stack   stack.Stack
+	elapsed time.Duration // time between the first sample and the exit
+}
+
+// exitTracker records how long the unexpected goroutines
+// from the first sample take to exit.
+type exitTracker struct {
+	started bool
+	start   time.Time
+	pending []stack.Stack // still alive in the last sample
+	exited  []slowExit
+}
+
+// observe records a sample of unexpected goroutines taken at the given time.
+func (t *exitTracker) observe(now time.Time, stacks []stack.Stack) {
+	if !t.started {
+		t.started = true
+		t.start = now
+		t.pending = append(t.pending, stacks...)
+		return
+	}
+
+	alive := make(map[int]struct{}, len(stacks))
+	for _, s := range stacks {
+		alive[s.ID()] = struct{}{}
+	}
+
+	pending := t.pending[:0]
+	for _, s := range t.pending {
+		if _, ok := alive[s.ID()]; ok {
+			pending = append(pending, s)
+			continue
+		}
+		t.exited = append(t.exited, slowExit{stack: s, elapsed: now.Sub(t.start)})
+	}
+	t.pending = pending
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/internal/stack"
+)
+
+func TestExitTracker(t *testing.T) {
+	bg1 := startBlockedG()
+	bg2 := startBlockedG()
+	defer bg2.unblock()
+
+	cur := stack.Current().ID()
+	opts := buildOpts()
+	sample := func() []stack.Stack {
+		return filterStacks(stack.All(), cur, opts)
+	}
+
+	var tracker exitTracker
+	start := time.Now()
+	tracker.observe(start, sample())
+	require.Len(t, tracker.pending, 2)
+
+	tracker.observe(start.Add(time.Second), sample())
+	assert.Empty(t, tracker.exited, "No goroutines have exited yet")
+
+	bg1.unblock()
+	require.NoError(t, Find(IgnoreCurrent()), "wait for blocked goroutine to exit")
+	tracker.observe(start.Add(2*time.Second), sample())
+	require.Len(t, tracker.exited, 1)
+	assert.Equal(t, 2*time.Second, tracker.exited[0].elapsed)
+	assert.Len(t, tracker.pending, 1)
+
+	// Goroutines started after the first sample are not tracked.
+	bg3 := startBlockedG()
+	bg3.unblock()
+	tracker.observe(start.Add(3*time.Second), sample())
+	assert.Len(t, tracker.exited, 1)
+}
+
+func TestWarnSlowExits(t *testing.T) {
+	slowG := func(d time.Duration) {
+		bg := startBlockedG()
+		go func() {
+			time.Sleep(d)
+			bg.unblock()
+		}()
+	}
+
+	t.Run("VerifyNone logs to test", func(t *testing.T) {
+		ft := &fakeT{}
+		slowG(50 * time.Millisecond)
+		VerifyNone(ft, WarnSlowExits(10*time.Millisecond))
+		assert.Empty(t, ft.errors, "Slow exits should not fail the test")
+		// Both the blocked goroutine and the one unblocking it are slow.
+		require.Len(t, ft.logs, 2)
+		assert.Contains(t, ft.logs[0], "goleak: goroutine took")
+		assert.Contains(t, strings.Join(ft.logs, "\n"), "blockedG")
+	})
+
+	t.Run("below threshold", func(t *testing.T) {
+		ft := &fakeT{}
+		slowG(time.Millisecond)
+		VerifyNone(ft, WarnSlowExits(time.Minute))
+		assert.Empty(t, ft.errors)
+		assert.Empty(t, ft.logs)
+	})
+
+	t.Run("Find writes to stderr", func(t *testing.T) {
+		defer clearOSStubs()
+		exitCode, stderr := osStubs()
+
+		slowG(50 * time.Millisecond)
+		require.NoError(t, Find(WarnSlowExits(10*time.Millisecond)))
+		_osExit(0)
+		<-exitCode
+		assert.Contains(t, <-stderr, "goleak: goroutine took")
+	})
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"fmt"
+
+	"go.uber.org/goleak/internal/stack"
+)
+
+// ExpectGoroutines marks the given TestingT as failed unless exactly count
+// goroutines that match m are running, not counting the calling goroutine.
+//
+// This is the opposite of a leak check: use it to verify that a background
+// worker that should be running has not died, e.g.,
+//
+//	goleak.ExpectGoroutines(t, goleak.TopFunction("example.com/foo.(*Worker).run"), 1)
+//
+// Use [ExpectGoroutinesEventually] to wait for goroutines to start or exit.
+func ExpectGoroutines(t TestingT, m Matcher, count int) {
+	if h, ok := t.(testHelper); ok {
+		// Mark this function as a test helper, if available.
+		h.Helper()
+	}
+
+	if err := expectGoroutines(m, count, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// ExpectGoroutinesEventually is similar to [ExpectGoroutines],
+// but it retries the same way as [Find] until exactly count goroutines
+// that match m are running.
+// It fails the TestingT if that doesn't happen before it gives up.
+//
+// Only options that control retries, such as [Timeout], apply;
+// filters and hooks are ignored because m selects the goroutines.
+// Invalid options, e.g., an unknown [IgnorePreset], still fail the TestingT.
+func ExpectGoroutinesEventually(t TestingT, m Matcher, count int, options ...Option) {
+	if h, ok := t.(testHelper); ok {
+		// Mark this function as a test helper, if available.
+		h.Helper()
+	}
+
+	opts := buildOpts(options...)
+	if err := opts.err(); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := expectGoroutines(m, count, opts); err != nil {
+		t.Error(err)
+	}
+}
+
+// expectGoroutines checks that exactly count goroutines that match m
+// are running. If opts is non-nil, it retries until that's the case.
+func expectGoroutines(m Matcher, count int, opts *opts) error {
+	cur := stack.Current().ID()
+
+	var matched []stack.Stack
+	retry := true
+	for i := 0; retry; i++ {
+		matched = matched[:0]
+		for _, s := range stack.All() {
+			if s.ID() != cur && m(Goroutine{s: s}) {
+				matched = append(matched, s)
+			}
+		}
+
+		if len(matched) == count || opts == nil {
+			break
+		}
+		retry = opts.retry(i)
+	}
+
+	if len(matched) != count {
+		return fmt.Errorf("expected %d matching goroutines, found %d:\n%s", count, len(matched), matched)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectGoroutines(t *testing.T) {
+	blocked := TopFunction("go.uber.org/goleak.(*blockedG).block")
+
+	t.Run("none running", func(t *testing.T) {
+		ft := &fakeT{}
+		ExpectGoroutines(ft, blocked, 0)
+		assert.Empty(t, ft.errors)
+
+		ExpectGoroutines(ft, blocked, 1)
+		require.Len(t, ft.errors, 1)
+		assert.Contains(t, ft.errors[0], "expected 1 matching goroutines, found 0")
+	})
+
+	t.Run("running", func(t *testing.T) {
+		bg1 := startBlockedG()
+		defer bg1.unblock()
+		bg2 := startBlockedG()
+		defer bg2.unblock()
+
+		ft := &fakeT{}
+		ExpectGoroutines(ft, blocked, 2)
+		assert.Empty(t, ft.errors)
+
+		ExpectGoroutines(ft, CreatedBy("go.uber.org/goleak.startBlockedG"), 1)
+		require.Len(t, ft.errors, 1)
+		assert.Contains(t, ft.errors[0], "expected 1 matching goroutines, found 2")
+		assert.Contains(t, ft.errors[0], "blockedG")
+	})
+}
+
+func TestExpectGoroutinesEventually(t *testing.T) {
+	blocked := TopFunction("go.uber.org/goleak.(*blockedG).block")
+
+	t.Run("waits for start", func(t *testing.T) {
+		var bg *blockedG
+		started := make(chan struct{})
+		go func() {
+			defer close(started)
+			time.Sleep(10 * time.Millisecond)
+			bg = startBlockedG()
+		}()
+		defer func() {
+			<-started
+			bg.unblock()
+		}()
+
+		ft := &fakeT{}
+		ExpectGoroutinesEventually(ft, blocked, 1)
+		assert.Empty(t, ft.errors)
+	})
+
+	t.Run("waits for exit", func(t *testing.T) {
+		bg := startBlockedG()
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			bg.unblock()
+		}()
+
+		ft := &fakeT{}
+		ExpectGoroutinesEventually(ft, blocked, 0)
+		assert.Empty(t, ft.errors)
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		ft := &fakeT{}
+		ExpectGoroutinesEventually(ft, blocked, 1, testOptions())
+		require.Len(t, ft.errors, 1)
+		assert.Contains(t, ft.errors[0], "expected 1 matching goroutines, found 0")
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		ft := &fakeT{}
+		ExpectGoroutinesEventually(ft, blocked, 0, IgnorePreset("unknown"))
+		require.Len(t, ft.errors, 1)
+		assert.Contains(t, ft.errors[0], "unknown")
+	})
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"time"
+
+	"go.uber.org/goleak/internal/stack"
+)
+
+// Goroutine is a goroutine observed by goleak.
+type Goroutine struct {
+	s stack.Stack
+}
+
+func newGoroutines(stacks []stack.Stack) []Goroutine {
+	gs := make([]Goroutine, len(stacks))
+	for i, s := range stacks {
+		gs[i] = Goroutine{s: s}
+	}
+	return gs
+}
+
+// ID returns the goroutine ID.
+func (g Goroutine) ID() int {
+	return g.s.ID()
+}
+
+// State returns the state of the goroutine,
+// e.g. "running" or "chan receive".
+func (g Goroutine) State() string {
+	return g.s.State()
+}
+
+// WaitDuration returns how long the goroutine has been blocked.
+// The runtime only reports this in whole minutes
+// for goroutines that have been blocked for at least a minute,
+// so it's 0 for all other goroutines.
+func (g Goroutine) WaitDuration() time.Duration {
+	return g.s.WaitDuration()
+}
+
+// TopFunction returns the fully qualified name of the function
+// at the top of the goroutine's stack.
+func (g Goroutine) TopFunction() string {
+	return g.s.FirstFunction()
+}
+
+// CreatedBy returns the fully qualified name of the function
+// that started the goroutine.
+// It is empty for the main goroutine.
+func (g Goroutine) CreatedBy() string {
+	return g.s.CreatedBy()
+}
+
+// CreatedAt returns the file and line of the go statement
+// that started the goroutine.
+// The file is empty for the main goroutine.
+func (g Goroutine) CreatedAt() (file string, line int) {
+	return g.s.CreatedAt()
+}
+
+// ParentID returns the ID of the goroutine that started this goroutine.
+// It is 0 if unknown, e.g. for the main goroutine.
+// Before Go 1.21, it's only known if GODEBUG=tracebackancestors=N is set.
+func (g Goroutine) ParentID() int {
+	return g.s.ParentID()
+}
+
+// Ancestors returns the goroutines that started this goroutine,
+// starting with its parent, as they were when each started the next.
+// Use this to trace a goroutine back to the code that caused it to start.
+//
+// Ancestors are only available if GODEBUG=tracebackancestors=N is set,
+// and only up to N of them. They don't have a state.
+func (g Goroutine) Ancestors() []Goroutine {
+	return newGoroutines(g.s.Ancestors())
+}
+
+// Test returns the name of the test that started the goroutine,
+// if that test called [Track].
+func (g Goroutine) Test() string {
+	return g.s.Labels()[_testLabel]
+}
+
+// HasFunction reports whether the function with the given
+// fully qualified name is anywhere in the goroutine's stack.
+// Closures and wrappers match like they do for [IgnoreTopFunction].
+func (g Goroutine) HasFunction(name string) bool {
+	return newFuncMatcher(name).in(g.s)
+}
+
+// ParseError returns the reason goleak failed to parse
+// the goroutine's stack trace, or nil if it was parsed.
+// This may happen with a Go release that changed the stack trace format.
+// Only the ID, State, and Stack of such a goroutine are known.
+func (g Goroutine) ParseError() error {
+	return g.s.ParseError()
+}
+
+// Stack returns the full stack trace of the goroutine.
+func (g Goroutine) Stack() string {
+	return g.s.Full()
+}
+
+func (g Goroutine) String() string {
+	return g.s.String()
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/internal/stack"
+)
+
+func TestGoroutine(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	var leaks []Goroutine
+	require.Error(t, Find(testOptions(), OnLeak(func(gs []Goroutine) {
+		leaks = gs
+	})))
+	require.Len(t, leaks, 1)
+
+	g := leaks[0]
+	assert.NotZero(t, g.ID())
+	assert.Equal(t, "chan receive", g.State())
+	assert.Equal(t, "go.uber.org/goleak.(*blockedG).block", g.TopFunction())
+	assert.Equal(t, "go.uber.org/goleak.startBlockedG", g.CreatedBy())
+	assert.True(t, g.HasFunction("go.uber.org/goleak.(*blockedG).run"))
+	assert.False(t, g.HasFunction("go.uber.org/goleak.startBlockedG"))
+	assert.Contains(t, g.Stack(), "utils_test.go")
+	file, line := g.CreatedAt()
+	assert.True(t, strings.HasSuffix(file, "/utils_test.go"), "unexpected file: %v", file)
+	assert.NotZero(t, line)
+	assert.Contains(t, g.String(), "on top of the stack")
+	assert.Empty(t, g.Ancestors(), "ancestors require GODEBUG=tracebackancestors")
+	if hasParentIDs() {
+		assert.Equal(t, stack.Current().ID(), g.ParentID())
+	}
+}
+
+func TestGoroutineHasFunctionCanonical(t *testing.T) {
+	stacks, err := stack.Parse(strings.NewReader(strings.Join([]string{
+		"goroutine 2 [chan receive]:",
+		"example.com/foo.F.func1()",
+		"	/path/to/example.com/foo/foo.go:12 +0x1d",
+		"created by example.com/foo.F in goroutine 1",
+		"	/path/to/example.com/foo/foo.go:10 +0x3f",
+		"",
+	}, "\n")))
+	require.NoError(t, err)
+	require.Len(t, stacks, 1)
+	g := Goroutine{s: stacks[0]}
+
+	assert.True(t, g.HasFunction("example.com/foo.F.func1"), "exact name")
+	assert.True(t, g.HasFunction("example.com/foo.F"), "declared function")
+	assert.False(t, g.HasFunction("example.com/foo.F.func2"), "other closure")
+	assert.Equal(t, g.HasFunction("example.com/foo.F.func2"), AnyFunction("example.com/foo.F.func2")(g),
+		"HasFunction should match like AnyFunction")
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.uber.org/goleak/internal/stack"
+)
+
+// _growthSamples is the maximum number of times VerifyNoGrowth
+// counts goroutines while running fn.
+const _growthSamples = 20
+
+type benchTimer interface {
+	StartTimer()
+	StopTimer()
+}
+
+// VerifyNoGrowth runs fn the given number of times, and marks the given
+// TestingT as failed if any group of goroutines grows linearly with the
+// number of runs. Goroutines are grouped by the function that created them,
+// or by the function at the top of their stack if that's unknown.
+//
+// This catches leaks of one goroutine per call that may otherwise be hidden
+// by other, long-lived goroutines. Goroutines are counted after up to 20
+// runs, evenly spaced over all iterations, and a group is considered
+// growing if it gains at least one goroutine for every two runs.
+// At least two iterations are needed to detect growth.
+// Before failing, VerifyNoGrowth retries the same way as [Find]
+// to give goroutines a chance to exit.
+//
+// VerifyNoGrowth honors the filters passed as options,
+// and works with benchmarks:
+//
+//	func BenchmarkFoo(b *testing.B) {
+//	  goleak.VerifyNoGrowth(b, func() { foo() }, b.N)
+//	}
+//
+// For benchmarks, the timer is stopped while goroutines are counted.
+func VerifyNoGrowth(t TestingT, fn func(), iterations int, options ...Option) {
+	if h, ok := t.(testHelper); ok {
+		// Mark this function as a test helper, if available.
+		h.Helper()
+	}
+
+	opts := buildOpts(options...)
+	cur := stack.Current().ID()
+	timer, _ := t.(benchTimer)
+	sample := func() map[string][]stack.Stack {
+		if timer != nil {
+			timer.StopTimer()
+			defer timer.StartTimer()
+		}
+		stacks, _ := filteredStacks(cur, opts)
+		return groupStacks(stacks)
+	}
+
+	baseline := sample()
+	runs := sampleRuns(iterations)
+	counts := make(map[string][]int) // group => count after each sampled run
+	for i, next := 1, 0; i <= iterations; i++ {
+		fn()
+		if i != runs[next] {
+			continue
+		}
+		for key, stacks := range sample() {
+			if counts[key] == nil {
+				counts[key] = make([]int, len(runs))
+			}
+			counts[key][next] = len(stacks)
+		}
+		next++
+	}
+	if iterations < 2 {
+		return
+	}
+
+	candidates := make(map[string]struct{})
+	for key, c := range counts {
+		if growthRate(runs, c) >= 0.5 {
+			candidates[key] = struct{}{}
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	// Goroutines may still be exiting.
+	// Fail only if the growing groups have not shrunk back.
+	var growing []string
+	retry := true
+	for i := 0; retry; i++ {
+		growing = growingGroups(candidates, baseline, sample(), iterations)
+		if len(growing) == 0 {
+			return
+		}
+		retry = opts.retry(i)
+	}
+
+	t.Error(fmt.Sprintf("found goroutines growing over %d iterations:\n%s",
+		iterations, strings.Join(growing, "\n")))
+}
+
+// groupStacks groups the given stacks by the function that created them,
+// or the function at the top of their stack if that's unknown.
+func groupStacks(stacks []stack.Stack) map[string][]stack.Stack {
+	groups := make(map[string][]stack.Stack)
+	for _, s := range stacks {
+		key := "created by " + s.CreatedBy()
+		if s.CreatedBy() == "" {
+			key = "with top function " + s.FirstFunction()
+		}
+		groups[key] = append(groups[key], s)
+	}
+	return groups
+}
+
+// sampleRuns returns the runs, numbered from 1, after which
+// goroutines are counted: up to _growthSamples runs,
+// evenly spaced over the given number of iterations
+// and ending with the last one.
+func sampleRuns(iterations int) []int {
+	n := iterations
+	if n > _growthSamples {
+		n = _growthSamples
+	} else if n < 0 {
+		n = 0
+	}
+	runs := make([]int, n)
+	for i := range runs {
+		runs[i] = (i + 1) * iterations / n
+	}
+	return runs
+}
+
+// growthRate returns the slope of the least-squares line
+// through the given counts after the given runs:
+// the average growth per run.
+func growthRate(runs, counts []int) float64 {
+	n := float64(len(counts))
+	var sumX, sumY, sumXY, sumXX float64
+	for i, c := range counts {
+		x, y := float64(runs[i]), float64(c)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	return (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+}
+
+// growingGroups returns a description of each of the given groups
+// that still has at least one more goroutine for every two iterations.
+func growingGroups(groups map[string]struct{}, before, after map[string][]stack.Stack, iterations int) []string {
+	var growing []string
+	for key := range groups {
+		stacks := after[key]
+		growth := len(stacks) - len(before[key])
+		if growth <= 0 || growth*2 < iterations {
+			continue
+		}
+		growing = append(growing, fmt.Sprintf("%d new goroutines %s, e.g. %v",
+			growth, key, stacks[len(stacks)-1]))
+	}
+	sort.Strings(growing)
+	return growing
+}
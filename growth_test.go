@@ -0,0 +1,152 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeB struct {
+	fakeT
+
+	stops, starts int
+}
+
+func (b *fakeB) StopTimer()  { b.stops++ }
+func (b *fakeB) StartTimer() { b.starts++ }
+
+func TestVerifyNoGrowth(t *testing.T) {
+	t.Run("goroutine per call", func(t *testing.T) {
+		var bgs []*blockedG
+		defer func() {
+			for _, bg := range bgs {
+				bg.unblock()
+			}
+		}()
+
+		ft := &fakeT{}
+		VerifyNoGrowth(ft, func() {
+			bgs = append(bgs, startBlockedG())
+		}, 10, testOptions())
+		require.Len(t, ft.errors, 1)
+		assert.Contains(t, ft.errors[0], "found goroutines growing over 10 iterations")
+		assert.Contains(t, ft.errors[0], "10 new goroutines created by go.uber.org/goleak.startBlockedG")
+	})
+
+	t.Run("short-lived goroutines", func(t *testing.T) {
+		ft := &fakeT{}
+		VerifyNoGrowth(ft, func() {
+			startBlockedG().unblock()
+		}, 10)
+		assert.Empty(t, ft.errors)
+	})
+
+	t.Run("bounded goroutines", func(t *testing.T) {
+		var (
+			once sync.Once
+			bg   *blockedG
+		)
+		defer func() { bg.unblock() }()
+
+		ft := &fakeT{}
+		VerifyNoGrowth(ft, func() {
+			once.Do(func() { bg = startBlockedG() })
+		}, 10, testOptions())
+		assert.Empty(t, ft.errors, "A single long-lived goroutine is not growth")
+	})
+
+	t.Run("slow growth", func(t *testing.T) {
+		var bgs []*blockedG
+		defer func() {
+			for _, bg := range bgs {
+				bg.unblock()
+			}
+		}()
+
+		var calls int
+		ft := &fakeT{}
+		VerifyNoGrowth(ft, func() {
+			calls++
+			if calls%4 == 0 {
+				bgs = append(bgs, startBlockedG())
+			}
+		}, 20, testOptions())
+		assert.Empty(t, ft.errors, "Growth slower than one per two iterations is ignored")
+	})
+
+	t.Run("benchmark timer", func(t *testing.T) {
+		fb := &fakeB{}
+		VerifyNoGrowth(fb, func() {}, 5)
+		assert.Empty(t, fb.errors)
+		assert.Equal(t, 6, fb.stops, "timer should be stopped for the baseline and after each run")
+		assert.Equal(t, fb.stops, fb.starts)
+	})
+
+	t.Run("many iterations", func(t *testing.T) {
+		var bgs []*blockedG
+		defer func() {
+			for _, bg := range bgs {
+				bg.unblock()
+			}
+		}()
+
+		fb := &fakeB{}
+		VerifyNoGrowth(fb, func() {
+			bgs = append(bgs, startBlockedG())
+		}, 1000, testOptions())
+		require.Len(t, fb.errors, 1)
+		assert.Contains(t, fb.errors[0], "1000 new goroutines created by go.uber.org/goleak.startBlockedG")
+		// The baseline, 20 samples, and at least one retry.
+		assert.GreaterOrEqual(t, fb.stops, 22, "goroutines should be counted a bounded number of times")
+		assert.Less(t, fb.stops, 50, "goroutines should be counted a bounded number of times")
+	})
+
+	t.Run("negative iterations", func(t *testing.T) {
+		ft := &fakeT{}
+		VerifyNoGrowth(ft, func() {
+			t.Error("fn should not be called")
+		}, -1)
+		assert.Empty(t, ft.errors)
+	})
+}
+
+func TestSampleRuns(t *testing.T) {
+	assert.Empty(t, sampleRuns(-1))
+	assert.Empty(t, sampleRuns(0))
+	assert.Equal(t, []int{1, 2, 3}, sampleRuns(3))
+	assert.Equal(t, []int{5, 10, 15, 20, 25, 30, 35, 40, 45, 50, 55, 60, 65, 70, 75, 80, 85, 90, 95, 100}, sampleRuns(100))
+
+	runs := sampleRuns(1001)
+	assert.Len(t, runs, _growthSamples)
+	assert.Equal(t, 1001, runs[len(runs)-1], "last run should be sampled")
+}
+
+func TestGrowthRate(t *testing.T) {
+	assert.InDelta(t, 0, growthRate([]int{1, 2, 3, 4}, []int{3, 3, 3, 3}), 0.001)
+	assert.InDelta(t, 1, growthRate([]int{1, 2, 3, 4}, []int{1, 2, 3, 4}), 0.001)
+	assert.InDelta(t, 0.5, growthRate([]int{1, 2, 3, 4, 5, 6}, []int{0, 0, 1, 1, 2, 2}), 0.1)
+	assert.InDelta(t, 0, growthRate([]int{1, 2, 3, 4, 5, 6, 7, 8}, []int{1, 5, 1, 5, 1, 5, 5, 1}), 0.2, "noise is not growth")
+	assert.InDelta(t, 1, growthRate([]int{10, 20, 30}, []int{10, 20, 30}), 0.001, "growth is per run, not per sample")
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package stack
+
+import (
+	"bytes"
+	"fmt"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+)
+
+// _keyFrames is the maximum number of frames used to match
+// a goroutine's stack trace with its goroutine profile record.
+// The profile may truncate deep stacks.
+const _keyFrames = 16
+
+// AllWithLabels returns the stacks for all running goroutines,
+// with the profiler labels of each goroutine.
+//
+// runtime.Stack doesn't include labels,
+// so they are read from the goroutine profile instead,
+// and matched with stacks by the functions on them.
+// This is best-effort: goroutines that change between the two captures
+// may be assigned the wrong labels or none at all.
+// Goroutines with the same functions on their stacks
+// but different labels can't be told apart,
+// so none of them are assigned labels.
+func AllWithLabels() []Stack {
+	return FilterWithLabels(nil)
+}
+
+// FilterWithLabels is a variant of Filter that returns stacks
+// with their profiler labels, like AllWithLabels.
+// Labels are assigned before keep is called,
+// so keep may use them.
+func FilterWithLabels(keep func(Stack) bool) []Stack {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return getStacks(true, nil, keep)
+	}
+	records, err := parseProfile(buf.String())
+	if err != nil {
+		return getStacks(true, nil, keep)
+	}
+	return getStacks(true, newLabeler(records), keep)
+}
+
+// profileRecord is a group of goroutines with the same stack and labels
+// in a goroutine profile.
+type profileRecord struct {
+	count  int
+	labels map[string]string
+	key    string // see stackKey
+}
+
+// labeler assigns labels from goroutine profile records
+// to the matching stacks.
+// It maps the keys of records (see stackKey) to their labels.
+//
+// Records are matched with stacks by their functions only,
+// so goroutines with the same key are indistinguishable.
+// A key whose records have different labels is ambiguous:
+// it's mapped to no labels at all
+// rather than to labels that may belong to another goroutine.
+type labeler map[string]map[string]string
+
+func newLabeler(records []*profileRecord) labeler {
+	l := make(labeler, len(records))
+	for _, r := range records {
+		labels := r.labels
+		if prev, ok := l[r.key]; ok && !equalLabels(prev, labels) {
+			labels = nil
+		}
+		l[r.key] = labels
+	}
+	return l
+}
+
+// label assigns labels to the given stack
+// from the records with the same key.
+func (l labeler) label(s *Stack) {
+	s.labels = l[stackKey(s)]
+}
+
+func equalLabels(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// stackKey returns a key for the given stack
+// that can be compared with the key of a goroutine profile record.
+// It's made of the functions on the stack, from the top,
+// skipping the runtime functions that only one of the two includes.
+func stackKey(s *Stack) string {
+	var funcs []string
+	for _, line := range strings.Split(s.Full(), "\n") {
+		if len(line) == 0 || line[0] == '\t' {
+			continue
+		}
+		name, creator, err := parseFuncName(line)
+		if err != nil || creator {
+			continue
+		}
+		funcs = appendKeyFunc(funcs, name)
+	}
+	return strings.Join(funcs, "\n")
+}
+
+func appendKeyFunc(funcs []string, name string) []string {
+	if len(funcs) >= _keyFrames || strings.HasPrefix(name, "runtime.") {
+		return funcs
+	}
+	return append(funcs, name)
+}
+
+// parseProfile parses a goroutine profile written with debug=1.
+// It looks like:
+//
+//	goroutine profile: total 2
+//	1 @ 0x47d82a 0x41512e 0x4e1579 0x4835c1
+//	# labels: {"key":"value"}
+//	#	0x4e1578	main.block+0x18	/path/to/main.go:10
+//
+//	1 @ 0x47d82a 0x41512e 0x4e15b9 0x4835c1
+//	#	0x4e15b8	main.block+0x18	/path/to/main.go:10
+func parseProfile(profile string) ([]*profileRecord, error) {
+	var (
+		records []*profileRecord
+		cur     *profileRecord
+		funcs   []string
+	)
+	flush := func() {
+		if cur != nil {
+			cur.key = strings.Join(funcs, "\n")
+			records = append(records, cur)
+		}
+		cur, funcs = nil, nil
+	}
+
+	scan := newScanner(profile)
+	for scan.Scan() {
+		line := scan.Text()
+		switch {
+		case len(line) == 0:
+			flush()
+
+		case strings.HasPrefix(line, "# labels: "):
+			if cur == nil {
+				continue
+			}
+			labels, err := parseLabels(strings.TrimPrefix(line, "# labels: "))
+			if err != nil {
+				return nil, err
+			}
+			cur.labels = labels
+
+		case strings.HasPrefix(line, "#\t"):
+			// #	0x4e1578	main.block+0x18	/path/to/main.go:10
+			fields := strings.Split(line, "\t")
+			if cur == nil || len(fields) < 3 {
+				continue
+			}
+			name := fields[2]
+			if idx := strings.LastIndex(name, "+0x"); idx >= 0 {
+				name = name[:idx]
+			}
+			funcs = appendKeyFunc(funcs, name)
+
+		default:
+			// 1 @ 0x47d82a 0x41512e 0x4e1579 0x4835c1
+			countStr, _, ok := strings.Cut(line, " @ ")
+			if !ok {
+				continue
+			}
+			flush()
+			count, err := strconv.Atoi(countStr)
+			if err != nil {
+				return nil, fmt.Errorf("bad count in line %q", line)
+			}
+			cur = &profileRecord{count: count}
+		}
+	}
+	flush()
+	return records, nil
+}
+
+// parseLabels parses labels from a goroutine profile
+// that look like:
+//
+//	{"key1":"value1", "key2":"value2"}
+func parseLabels(s string) (map[string]string, error) {
+	orig := s
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+
+	labels := make(map[string]string)
+	for len(s) > 0 {
+		key, rest, err := cutQuoted(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad label key in %q: %w", orig, err)
+		}
+		rest, ok := strings.CutPrefix(rest, ":")
+		if !ok {
+			return nil, fmt.Errorf("missing ':' after label key in %q", orig)
+		}
+		value, rest, err := cutQuoted(rest)
+		if err != nil {
+			return nil, fmt.Errorf("bad label value in %q: %w", orig, err)
+		}
+		labels[key] = value
+		s = strings.TrimPrefix(rest, ", ")
+	}
+	return labels, nil
+}
+
+// cutQuoted unquotes the Go string literal at the start of s,
+// and returns it with the rest of s.
+func cutQuoted(s string) (value, rest string, err error) {
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", "", err
+	}
+	value, err = strconv.Unquote(quoted)
+	return value, s[len(quoted):], err
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package stack
+
+import (
+	"context"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func waitForLabelsDone(done chan struct{}) {
+	<-done
+}
+
+func TestAllWithLabels(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	started := make(chan struct{})
+	pprof.Do(context.Background(), pprof.Labels("test", "labeled"), func(context.Context) {
+		go func() {
+			close(started)
+			waitForLabelsDone(done)
+		}()
+	})
+	<-started
+
+	var labeled, unlabeled int
+	for retry := 0; retry < 100; retry++ {
+		labeled, unlabeled = 0, 0
+		for _, s := range AllWithLabels() {
+			if !s.HasFunction("go.uber.org/goleak/internal/stack.waitForLabelsDone") {
+				continue
+			}
+			if s.Labels()["test"] == "labeled" {
+				labeled++
+			} else {
+				unlabeled++
+			}
+		}
+		if labeled == 1 {
+			break
+		}
+	}
+	assert.Equal(t, 1, labeled, "labeled goroutine should have labels")
+	assert.Zero(t, unlabeled)
+
+	for _, s := range All() {
+		assert.Nil(t, s.Labels(), "All should not read labels")
+	}
+}
+
+func TestFilterWithLabels(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	started := make(chan struct{})
+	pprof.Do(context.Background(), pprof.Labels("test", "filter"), func(context.Context) {
+		go func() {
+			close(started)
+			waitForLabelsDone(done)
+		}()
+	})
+	<-started
+
+	var got []Stack
+	for retry := 0; retry < 100 && len(got) != 1; retry++ {
+		got = FilterWithLabels(func(s Stack) bool {
+			// Labels must be available to keep.
+			return s.Labels()["test"] == "filter"
+		})
+	}
+	require.Len(t, got, 1)
+	assert.True(t, got[0].HasFunction("go.uber.org/goleak/internal/stack.waitForLabelsDone"))
+}
+
+func TestParseProfile(t *testing.T) {
+	profile := joinLines(
+		"goroutine profile: total 3",
+		"1 @ 0x47d82a 0x41512e 0x4e1479 0x4835c1",
+		"#	0x4e1478	main.block+0x18	/tmp/main.go:10",
+		"",
+		"2 @ 0x47d82a 0x41512e 0x4e1579 0x4835c1",
+		`# labels: {"a":"b", "test":"Test \"quoted\""}`,
+		"#	0x4e1578	main.block+0x18	/tmp/main.go:10",
+		"#	0x4e1600	main.main+0x20	/tmp/main.go:20",
+		"#	0x44aa26	runtime.main+0x426	/usr/local/go/src/runtime/proc.go:302",
+	)
+
+	records, err := parseProfile(profile)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	assert.Equal(t, 1, records[0].count)
+	assert.Nil(t, records[0].labels)
+	assert.Equal(t, "main.block", records[0].key)
+
+	assert.Equal(t, 2, records[1].count)
+	assert.Equal(t, map[string]string{"a": "b", "test": `Test "quoted"`}, records[1].labels)
+	assert.Equal(t, "main.block\nmain.main", records[1].key)
+}
+
+func TestLabeler(t *testing.T) {
+	stacks, err := newStackParser(joinLines(
+		"goroutine 1 [chan receive]:",
+		"main.block(...)",
+		"	/tmp/main.go:10",
+		"main.main()",
+		"	/tmp/main.go:20 +0x20",
+		"",
+		"goroutine 2 [chan receive]:",
+		"main.block(...)",
+		"	/tmp/main.go:10",
+		"created by main.main in goroutine 1",
+		"	/tmp/main.go:15 +0x20",
+		"",
+		"goroutine 3 [chan receive]:",
+		"main.block(...)",
+		"	/tmp/main.go:10",
+		"created by main.main in goroutine 1",
+		"	/tmp/main.go:16 +0x20",
+		"",
+		"goroutine 4 [chan receive]:",
+		"main.other(...)",
+		"	/tmp/main.go:30",
+		"created by main.main in goroutine 1",
+		"	/tmp/main.go:17 +0x20",
+	)).Parse()
+	require.NoError(t, err)
+
+	l := newLabeler([]*profileRecord{
+		{count: 1, key: "main.block\nmain.main", labels: map[string]string{"k": "main"}},
+		// Goroutines 2 and 3 can't be told apart,
+		// so neither should get these labels.
+		{count: 1, key: "main.block", labels: map[string]string{"k": "first"}},
+		{count: 1, key: "main.block"},
+		// Records with the same labels aren't ambiguous.
+		{count: 1, key: "main.other", labels: map[string]string{"k": "other"}},
+		{count: 2, key: "main.other", labels: map[string]string{"k": "other"}},
+	})
+	for i := range stacks {
+		l.label(&stacks[i])
+	}
+	assert.Equal(t, map[string]string{"k": "main"}, stacks[0].Labels())
+	assert.Nil(t, stacks[1].Labels(), "ambiguous labels should not be assigned")
+	assert.Nil(t, stacks[2].Labels(), "ambiguous labels should not be assigned")
+	assert.Equal(t, map[string]string{"k": "other"}, stacks[3].Labels())
+}
+
+func TestParseLabelsErrors(t *testing.T) {
+	tests := []struct {
+		give    string
+		wantErr string
+	}{
+		{`{a:"b"}`, "bad label key"},
+		{`{"a""b"}`, "missing ':'"},
+		{`{"a":b}`, "bad label value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.give, func(t *testing.T) {
+			_, err := parseLabels(tt.give)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
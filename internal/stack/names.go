@@ -0,0 +1,130 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package stack
+
+import "strings"
+
+// CanonicalFunction returns a form of the given fully qualified
+// function name that is stable across Go versions.
+//
+// Names that the compiler synthesizes for closures and wrappers
+// have changed between Go releases.
+// CanonicalFunction reduces them to the function
+// that they're declared in by removing:
+//
+//   - type arguments of generic functions and types, e.g. "F[...]"
+//   - the suffix of method values, e.g. "(*T).M-fm"
+//   - closure suffixes, e.g. "F.func1" and "F.func1.2"
+//   - go and defer statement wrappers, e.g. "F.gowrap1" and "F.deferwrap1"
+//   - repeated names from inlined closures, e.g. "F.F.func1.func2"
+//
+// Go 1.22 names a closure inside a closure that was inlined into its
+// own function by repeating the function's name, e.g. "F.F.func1.func2".
+// Repeated names are only collapsed in that form, so closures of
+// a method named after its type, e.g. "T.T.func1", become "T.T".
+//
+// For example, all of these become "example.com/foo.F":
+//
+//	example.com/foo.F
+//	example.com/foo.F.func1
+//	example.com/foo.F.gowrap2
+//	example.com/foo.F[...].func1.1
+//	example.com/foo.F.F.func1.func2
+func CanonicalFunction(name string) string {
+	name = stripTypeArgs(name)
+	name = strings.TrimSuffix(name, "-fm")
+
+	pkg := funcPackage(name)
+	if len(pkg) == len(name) {
+		// Not a fully qualified name.
+		return name
+	}
+
+	fn := name[len(pkg)+1:]
+	var (
+		suffixes int    // number of synthesized elements removed
+		first    string // the last one removed, e.g., "func1" in "F.func1.2"
+	)
+	for {
+		idx := strings.LastIndexByte(fn, '.')
+		if idx < 0 || !isSynthesized(fn[idx+1:]) {
+			break
+		}
+		first = fn[idx+1:]
+		fn = fn[:idx]
+		suffixes++
+	}
+
+	if suffixes > 1 && strings.HasPrefix(first, "func") {
+		// A closure in an inlined closure, e.g., "F.F.func1.func2".
+		if half := len(fn) / 2; len(fn)%2 == 1 && fn[half] == '.' && fn[:half] == fn[half+1:] {
+			fn = fn[:half]
+		}
+	}
+
+	return name[:len(pkg)+1+len(fn)]
+}
+
+// isSynthesized reports whether the given element of a function name
+// was added by the compiler for a closure or wrapper,
+// e.g. "func1", "gowrap2", or "3".
+func isSynthesized(part string) bool {
+	for _, prefix := range []string{"func", "gowrap", "deferwrap"} {
+		if rest, ok := strings.CutPrefix(part, prefix); ok {
+			part = rest
+			break
+		}
+	}
+	if len(part) == 0 {
+		return false
+	}
+	for i := 0; i < len(part); i++ {
+		if part[i] < '0' || part[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// stripTypeArgs removes the type arguments from a function name,
+// e.g. "F[...]" and "(*T[...]).M" become "F" and "(*T).M".
+func stripTypeArgs(name string) string {
+	if strings.IndexByte(name, '[') < 0 {
+		return name
+	}
+
+	var (
+		b     strings.Builder
+		depth int
+	)
+	b.Grow(len(name))
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; {
+		case c == '[':
+			depth++
+		case c == ']' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package stack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalFunction(t *testing.T) {
+	tests := []struct {
+		give string
+		want string
+	}{
+		{"example.com/foo.F", "example.com/foo.F"},
+		{"example.com/foo.F.func1", "example.com/foo.F"},
+		{"example.com/foo.F.func12.3", "example.com/foo.F"},
+		{"example.com/foo.F.gowrap1", "example.com/foo.F"},
+		{"example.com/foo.F.deferwrap2", "example.com/foo.F"},
+		{"example.com/foo.F.F.func1.1", "example.com/foo.F"},
+		{"example.com/foo.F.F.func1.func2", "example.com/foo.F"},
+		{"example.com/foo.F.F.func1.gowrap2", "example.com/foo.F"},
+		{"example.com/foo.F[...]", "example.com/foo.F"},
+		{"example.com/foo.F[...].func1", "example.com/foo.F"},
+		{"example.com/foo.(*T[...]).M", "example.com/foo.(*T).M"},
+		{"example.com/foo.(*T).M", "example.com/foo.(*T).M"},
+		{"example.com/foo.(*T).M-fm", "example.com/foo.(*T).M"},
+		{"example.com/foo.(*T).M.func1", "example.com/foo.(*T).M"},
+		{"example.com/foo.(*T).M.(*T).M.func1.func2", "example.com/foo.(*T).M"},
+		{"example.com/foo.glob..func1", "example.com/foo.glob."},
+		{"example.com/foo.init.0.func1", "example.com/foo.init"},
+		{"example.com/foo.v1.F.func1", "example.com/foo.v1.F"},
+		{"gopkg.in/yaml%2ev3.F.func1", "gopkg.in/yaml%2ev3.F"},
+		{"main.main.func1", "main.main"},
+		{"runtime.goexit", "runtime.goexit"},
+
+		// Names that aren't synthesized are left alone.
+		{"example.com/foo.F.funcs", "example.com/foo.F.funcs"},
+		{"example.com/foo.funcs", "example.com/foo.funcs"},
+		{"example.com/foo.func1", "example.com/foo.func1"},
+		{"example.com/foo.F.G", "example.com/foo.F.G"},
+		{"example.com/foo.T.T", "example.com/foo.T.T"},
+		{"example.com/foo.T.T-fm", "example.com/foo.T.T"},
+		{"example.com/foo.T.T.func1", "example.com/foo.T.T"},
+		{"example.com/foo.T.T.gowrap1", "example.com/foo.T.T"},
+		{"example.com/foo.T.T.T.T.func1.func2", "example.com/foo.T.T"},
+		{"example.com/foo.F.F.func1", "example.com/foo.F.F"},
+		{"example.com/foo.F.F.gowrap1.1", "example.com/foo.F.F"},
+		{"example.com/foo", "example.com/foo"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.give, func(t *testing.T) {
+			assert.Equal(t, tt.want, CanonicalFunction(tt.give))
+			assert.Equal(t, tt.want, CanonicalFunction(tt.want),
+				"canonical name should be stable")
+		})
+	}
+}
+
+func TestCanonicalFunctionAllocs(t *testing.T) {
+	allocs := testing.AllocsPerRun(100, func() {
+		CanonicalFunction("example.com/foo.(*T).M.func1.2")
+	})
+	assert.Zero(t, allocs)
+}
+
+func TestHasCanonicalFunction(t *testing.T) {
+	stacks, err := newStackParser(joinLines(
+		"goroutine 2 [chan receive]:",
+		"example.com/foo.(*T[...]).M.func1()",
+		"	example.com/foo/foo.go:10",
+		"example.com/foo.F.gowrap1()",
+		"	example.com/foo/foo.go:20",
+		"created by example.com/foo.G in goroutine 1",
+		"	example.com/foo/foo.go:30",
+	)).Parse()
+	require.NoError(t, err)
+	require.Len(t, stacks, 1)
+
+	s := stacks[0]
+	assert.True(t, s.HasCanonicalFunction("example.com/foo.(*T).M"))
+	assert.True(t, s.HasCanonicalFunction("example.com/foo.F"))
+	assert.False(t, s.HasCanonicalFunction("example.com/foo.F.gowrap1"),
+		"name must be canonical")
+	assert.False(t, s.HasCanonicalFunction("example.com/foo.G"),
+		"created by function is not part of the stack")
+}
@@ -20,37 +20,72 @@
 
 package stack
 
-import (
-	"bufio"
-	"io"
-)
+import "strings"
 
-// scanner provides a bufio.Scanner the ability to Unscan,
-// which allows the current token to be read again
+// scanner splits a string into lines, like bufio.Scanner,
+// with the ability to Unscan,
+// which allows the current line to be read again
 // after the next Scan.
+//
+// Lines returned by Text are substrings of the input,
+// so scanning doesn't allocate.
 type scanner struct {
-	*bufio.Scanner
+	s    string
+	line string
+
+	start int // offset of the current line
+	next  int // offset of the line after the current line
 
 	unscanned bool
 }
 
-func newScanner(r io.Reader) *scanner {
-	return &scanner{Scanner: bufio.NewScanner(r)}
+func newScanner(s string) *scanner {
+	return &scanner{s: s}
 }
 
+// Scan advances to the next line, which will then be available
+// through Text.
+// It returns false when there are no more lines.
 func (s *scanner) Scan() bool {
 	if s.unscanned {
 		s.unscanned = false
 		return true
 	}
-	return s.Scanner.Scan()
+	if s.next >= len(s.s) {
+		return false
+	}
+
+	s.start = s.next
+	if idx := strings.IndexByte(s.s[s.start:], '\n'); idx >= 0 {
+		s.line = s.s[s.start : s.start+idx]
+		s.next = s.start + idx + 1
+	} else {
+		s.line = s.s[s.start:]
+		s.next = len(s.s)
+	}
+	return true
+}
+
+// Text returns the current line, without the trailing newline.
+func (s *scanner) Text() string {
+	return s.line
 }
 
 // Unscan stops the scanner from advancing its position
 // for the next Scan.
 //
-// Bytes and Text will return the same token after next Scan
-// that they do right now.
+// Text will return the same line after next Scan
+// that it does right now.
 func (s *scanner) Unscan() {
 	s.unscanned = true
 }
+
+// Offset returns the offset in the input
+// of the first byte that has not been scanned yet,
+// not counting unscanned lines as scanned.
+func (s *scanner) Offset() int {
+	if s.unscanned {
+		return s.start
+	}
+	return s.next
+}
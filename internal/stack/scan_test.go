@@ -21,7 +21,6 @@
 package stack
 
 import (
-	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -29,7 +28,7 @@ import (
 )
 
 func TestScanner(t *testing.T) {
-	scanner := newScanner(strings.NewReader("foo\nbar\nbaz\n"))
+	scanner := newScanner("foo\nbar\nbaz\n")
 
 	require.True(t, scanner.Scan())
 	assert.Equal(t, "foo", scanner.Text())
@@ -45,4 +44,35 @@ func TestScanner(t *testing.T) {
 
 	require.True(t, scanner.Scan())
 	assert.Equal(t, "baz", scanner.Text())
+
+	assert.False(t, scanner.Scan())
+}
+
+func TestScannerNoTrailingNewline(t *testing.T) {
+	scanner := newScanner("foo\n\nbar")
+
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	assert.Equal(t, []string{"foo", "", "bar"}, lines)
+}
+
+func TestScannerOffset(t *testing.T) {
+	input := "foo\nbar\nbaz\n"
+	scanner := newScanner(input)
+	assert.Equal(t, 0, scanner.Offset())
+
+	require.True(t, scanner.Scan())
+	start := scanner.Offset()
+	assert.Equal(t, 4, start)
+
+	require.True(t, scanner.Scan())
+	require.True(t, scanner.Scan())
+	scanner.Unscan()
+	assert.Equal(t, "bar\n", input[start:scanner.Offset()],
+		"unscanned line should not be counted")
+
+	require.True(t, scanner.Scan())
+	assert.Equal(t, "bar\nbaz\n", input[start:scanner.Offset()])
 }
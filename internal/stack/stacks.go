@@ -21,17 +21,22 @@
 package stack
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 const _defaultBufferSize = 64 * 1024 // 64 KiB
 
+// _ancestorPrefix starts the traceback of an ancestor goroutine
+// if GODEBUG=tracebackancestors=N is set.
+const _ancestorPrefix = "[originating from goroutine "
+
 // Stack represents a single Goroutine's stack.
 type Stack struct {
 	id    int
@@ -40,14 +45,39 @@ type Stack struct {
 	// The function that spawned the goroutine.
 	createdBy string
 
+	// Location of the go statement that spawned the goroutine,
+	// or empty and 0 if unknown.
+	createdFile string
+	createdLine int
+
+	// ID of the goroutine that spawned this goroutine,
+	// or 0 if unknown.
+	parentID int
+
 	// The first function on the stack.
 	firstFunction string
 
 	// A set of all functions in the stack,
-	allFunctions map[string]struct{}
+	// built from fullStack on first use.
+	allFunctions *funcSet
 
 	// Full, raw stack trace.
+	// This may be a substring of the trace of all goroutines.
+	// See detach.
 	fullStack string
+
+	// Tracebacks of the goroutines that spawned this goroutine,
+	// starting with the parent, if GODEBUG=tracebackancestors=N is set.
+	ancestors []Stack
+
+	// Profiler labels of the goroutine,
+	// only set for stacks returned by AllWithLabels.
+	labels map[string]string
+
+	// Error that caused this stack to fail to parse, if any.
+	// If set, fullStack holds the raw stack trace,
+	// and only the ID and state may be known.
+	parseErr error
 }
 
 // ID returns the goroutine ID.
@@ -70,6 +100,44 @@ func (s Stack) CreatedBy() string {
 	return s.createdBy
 }
 
+// CreatedAt returns the file and line of the go statement
+// that spawned the goroutine.
+// The file is empty if it's unknown, e.g. for the main goroutine.
+func (s Stack) CreatedAt() (file string, line int) {
+	return s.createdFile, s.createdLine
+}
+
+// ParentID returns the ID of the goroutine that spawned this goroutine.
+// It is 0 if unknown, e.g. for the main goroutine,
+// or with Go versions older than 1.21.
+func (s Stack) ParentID() int {
+	return s.parentID
+}
+
+// Ancestors returns the stacks of the goroutines that spawned
+// this goroutine, starting with its parent,
+// at the time each of them spawned the next.
+// These are only available if GODEBUG=tracebackancestors=N is set,
+// and only include up to N ancestors.
+// Ancestor stacks don't have a state.
+func (s Stack) Ancestors() []Stack {
+	return s.ancestors
+}
+
+// Labels returns the profiler labels of the goroutine.
+// Labels are only available for stacks returned by AllWithLabels.
+func (s Stack) Labels() map[string]string {
+	return s.labels
+}
+
+// ParseError returns the error that caused this stack to fail to parse,
+// or nil if it was parsed successfully.
+// Stacks that failed to parse have their raw stack trace in Full,
+// and may have an ID and state, but nothing else.
+func (s Stack) ParseError() error {
+	return s.parseErr
+}
+
 // FirstFunction returns the name of the first function on the stack.
 func (s Stack) FirstFunction() string {
 	return s.firstFunction
@@ -78,37 +146,234 @@ func (s Stack) FirstFunction() string {
 // HasFunction reports whether the stack has the given function
 // anywhere in it.
 func (s Stack) HasFunction(name string) bool {
-	_, ok := s.allFunctions[name]
+	_, ok := s.allFunctions.get(s.fullStack)[name]
 	return ok
 }
 
+// HasCanonicalFunction reports whether the stack has a function
+// with the given canonical name (see CanonicalFunction) anywhere in it.
+func (s Stack) HasCanonicalFunction(name string) bool {
+	_, ok := s.allFunctions.getCanonical(s.fullStack)[name]
+	return ok
+}
+
+// HasPackage reports whether the stack has a function
+// from the given package anywhere in it.
+// The package is identified by its import path, e.g. "net/http".
+func (s Stack) HasPackage(pkg string) bool {
+	pkg = escapePackage(pkg)
+	for fn := range s.allFunctions.get(s.fullStack) {
+		if funcPackage(fn) == pkg {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPackageUnder reports whether the stack has a function
+// from the package with the given import path,
+// or from any package below it (see InPackageTree).
+func (s Stack) HasPackageUnder(root string) bool {
+	for fn := range s.allFunctions.get(s.fullStack) {
+		if InPackageTree(fn, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPosition reports whether the stack has a frame
+// at a file and line for which match returns true.
+// The position of the "created by" line isn't a frame of this stack,
+// so it's not considered.
+func (s Stack) HasPosition(match func(file string, line int) bool) bool {
+	var creator bool
+	scan := newScanner(s.fullStack)
+	for scan.Scan() {
+		line := scan.Text()
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] != '\t' {
+			creator = strings.HasPrefix(line, "created by ")
+			continue
+		}
+		if creator {
+			continue
+		}
+		if file, lineNo := parsePosition(line); file != "" && match(file, lineNo) {
+			return true
+		}
+	}
+	return false
+}
+
+// WaitDuration returns how long the goroutine has been blocked,
+// as reported in its state, e.g. "chan receive, 5 minutes".
+// The runtime only reports this in whole minutes
+// for goroutines that have been blocked for at least a minute,
+// so it's 0 for all other goroutines.
+func (s Stack) WaitDuration() time.Duration {
+	_, rest, _ := strings.Cut(s.state, ", ")
+	for len(rest) > 0 {
+		var field string
+		field, rest, _ = strings.Cut(rest, ", ")
+		if minutes, ok := strings.CutSuffix(field, " minutes"); ok {
+			if n, err := strconv.Atoi(minutes); err == nil {
+				return time.Duration(n) * time.Minute
+			}
+		}
+	}
+	return 0
+}
+
+// detach returns a copy of the stack that doesn't share memory
+// with the trace of all goroutines that it was parsed from,
+// so that the trace can be garbage collected.
+func (s Stack) detach() Stack {
+	s.state = strings.Clone(s.state)
+	s.createdBy = strings.Clone(s.createdBy)
+	s.createdFile = strings.Clone(s.createdFile)
+	s.firstFunction = strings.Clone(s.firstFunction)
+	s.fullStack = strings.Clone(s.fullStack)
+	if s.allFunctions != nil {
+		// The function names would point into the old trace.
+		s.allFunctions = new(funcSet)
+	}
+
+	if len(s.ancestors) > 0 {
+		ancestors := make([]Stack, len(s.ancestors))
+		for i, a := range s.ancestors {
+			ancestors[i] = a.detach()
+		}
+		s.ancestors = ancestors
+	}
+	return s
+}
+
+// funcSet is the set of functions in a stack trace.
+// Building it is relatively expensive,
+// so it's only done when it's first needed.
+type funcSet struct {
+	once  sync.Once
+	funcs map[string]struct{}
+
+	canonicalOnce sync.Once
+	canonical     map[string]struct{} // see CanonicalFunction
+}
+
+// get returns the set of functions in the given stack trace,
+// building it if necessary.
+// The trace must be the same on every call.
+func (fs *funcSet) get(fullStack string) map[string]struct{} {
+	if fs == nil {
+		// Stack that failed to parse.
+		return nil
+	}
+
+	fs.once.Do(func() {
+		fs.funcs = make(map[string]struct{})
+		for _, line := range strings.Split(fullStack, "\n") {
+			if len(line) == 0 || line[0] == '\t' || isElided(line) {
+				continue
+			}
+			// The stack was already parsed successfully,
+			// so this can only fail for lines we don't care about.
+			name, creator, err := parseFuncName(line)
+			if err == nil && !creator {
+				fs.funcs[name] = struct{}{}
+			}
+		}
+	})
+	return fs.funcs
+}
+
+// getCanonical is a variant of get
+// that returns the canonical names of the functions.
+func (fs *funcSet) getCanonical(fullStack string) map[string]struct{} {
+	if fs == nil {
+		return nil
+	}
+
+	fs.canonicalOnce.Do(func() {
+		funcs := fs.get(fullStack)
+		fs.canonical = make(map[string]struct{}, len(funcs))
+		for fn := range funcs {
+			fs.canonical[CanonicalFunction(fn)] = struct{}{}
+		}
+	})
+	return fs.canonical
+}
+
 func (s Stack) String() string {
-	return fmt.Sprintf(
+	if s.parseErr != nil {
+		return fmt.Sprintf(
+			"Goroutine %v in state %v, failed to parse (%v):\n%s",
+			s.id, s.state, s.parseErr, s.Full())
+	}
+
+	str := fmt.Sprintf(
 		"Goroutine %v in state %v, with %v on top of the stack:\n%s",
 		s.id, s.state, s.firstFunction, s.Full())
+	for _, a := range s.ancestors {
+		str += fmt.Sprintf("Originating from goroutine %v:\n%s", a.id, a.Full())
+	}
+	return str
 }
 
-func getStacks(all bool) []Stack {
-	trace := getStackBuffer(all)
-	stacks, err := newStackParser(bytes.NewReader(trace)).Parse()
+func getStacks(all bool, labels labeler, keep func(Stack) bool) []Stack {
+	// Well-formed stack traces should never fail to parse,
+	// but a new Go release may change the format.
+	// Parse in tolerant mode so that a stack we don't understand
+	// is reported with its parse error instead of crashing the test.
+	p := newStackParser(string(getStackBuffer(all)))
+	p.tolerant = true
+	p.labels = labels
+	p.keep = keep
+	stacks, _ := p.Parse() // can't fail in tolerant mode
+	return stacks
+}
+
+// Parse parses stack traces in the format written by runtime.Stack.
+//
+// Parse is tolerant of stacks it doesn't understand:
+// they're returned with the raw stack trace and an error
+// that's available from Stack.ParseError.
+// The returned error is non-nil only if r could not be read.
+func Parse(r io.Reader) ([]Stack, error) {
+	trace, err := io.ReadAll(r)
 	if err != nil {
-		// Well-formed stack traces should never fail to parse.
-		// If they do, it's a bug in this package.
-		// Panic so we can fix it.
-		panic(fmt.Sprintf("Failed to parse stack trace: %v\n%s", err, trace))
+		return nil, err
 	}
-	return stacks
+	p := newStackParser(string(trace))
+	p.tolerant = true
+	return p.Parse()
 }
 
 type stackParser struct {
+	trace  string
 	scan   *scanner
 	stacks []Stack
 	errors []error
+
+	// If set, stacks that fail to parse are returned
+	// with their raw stack trace and parse error
+	// instead of failing the whole parse.
+	tolerant bool
+
+	// If set, used to assign profiler labels to each stack.
+	labels labeler
+
+	// If set, only stacks for which keep returns true are returned.
+	// Their stack traces are copied out of the full trace,
+	// so that it doesn't stay in memory because of them.
+	keep func(Stack) bool
 }
 
-func newStackParser(r io.Reader) *stackParser {
+func newStackParser(trace string) *stackParser {
 	return &stackParser{
-		scan: newScanner(r),
+		trace: trace,
+		scan:  newScanner(trace),
 	}
 }
 
@@ -117,20 +382,65 @@ func (p *stackParser) Parse() ([]Stack, error) {
 		line := p.scan.Text()
 
 		// If we see the goroutine header, start a new stack.
-		if strings.HasPrefix(line, "goroutine ") {
-			stack, err := p.parseStack(line)
+		if !strings.HasPrefix(line, "goroutine ") {
+			continue
+		}
+
+		var stack Stack
+		if p.tolerant {
+			stack = p.parseStackTolerant(line)
+		} else {
+			var err error
+			stack, err = p.parseStack(line)
 			if err != nil {
 				p.errors = append(p.errors, err)
 				continue
 			}
-			p.stacks = append(p.stacks, stack)
 		}
+
+		if p.labels != nil {
+			p.labels.label(&stack)
+		}
+		if p.keep != nil {
+			if !p.keep(stack) {
+				continue
+			}
+			stack = stack.detach()
+		}
+		p.stacks = append(p.stacks, stack)
 	}
 
-	p.errors = append(p.errors, p.scan.Err())
 	return p.stacks, errors.Join(p.errors...)
 }
 
+// parseStackTolerant is a variant of parseStack
+// that doesn't fail if the stack can't be parsed.
+// Instead, it returns the raw stack trace with the parse error,
+// and the goroutine ID and state if the header could be parsed.
+func (p *stackParser) parseStackTolerant(line string) Stack {
+	start := p.scan.Offset()
+	stack, err := p.parseStack(line)
+	if err == nil {
+		return stack
+	}
+
+	// Skip the rest of the stack.
+	for p.scan.Scan() {
+		if strings.HasPrefix(p.scan.Text(), "goroutine ") {
+			p.scan.Unscan()
+			break
+		}
+	}
+
+	id, state, _ := parseGoStackHeader(line)
+	return Stack{
+		id:        id,
+		state:     state,
+		fullStack: p.trace[start:p.scan.Offset()],
+		parseErr:  err,
+	}
+}
+
 // parseStack parses a single stack trace from the given scanner.
 // line is the first line of the stack trace, which should look like:
 //
@@ -141,33 +451,63 @@ func (p *stackParser) parseStack(line string) (Stack, error) {
 		return Stack{}, fmt.Errorf("parse header: %w", err)
 	}
 
-	// Read the rest of the stack trace.
+	stack, err := p.parseFrames()
+	if err != nil {
+		return Stack{}, err
+	}
+	stack.id = id
+	stack.state = state
+
+	stack.ancestors, err = p.parseAncestors()
+	if err != nil {
+		return Stack{}, fmt.Errorf("parse ancestors: %w", err)
+	}
+	if stack.parentID == 0 && len(stack.ancestors) > 0 {
+		// Before Go 1.21, the "created by" line doesn't include
+		// the parent goroutine, but the ancestors do.
+		stack.parentID = stack.ancestors[0].id
+	}
+	return stack, nil
+}
+
+// parseFrames parses the frames of a single stack trace,
+// up to and including the "created by" line, if any.
+// The returned stack does not have an ID or state.
+func (p *stackParser) parseFrames() (Stack, error) {
 	var (
 		createdBy     string
+		createdFile   string
+		createdLine   int
+		parentID      int
 		firstFunction string
-		fullStack     bytes.Buffer
 	)
-	funcs := make(map[string]struct{})
+	start := p.scan.Offset()
 	for p.scan.Scan() {
 		line := p.scan.Text()
-		if strings.HasPrefix(line, "goroutine ") {
+		if strings.HasPrefix(line, "goroutine ") || strings.HasPrefix(line, _ancestorPrefix) {
 			// If we see the goroutine header,
+			// or the traceback of an ancestor,
 			// it's the end of this stack.
 			// Unscan so the next Scan sees the same line.
 			p.scan.Unscan()
 			break
 		}
 
-		fullStack.WriteString(line)
-		fullStack.WriteByte('\n') // scanner trims the newline
-
 		if len(line) == 0 {
 			// Empty line usually marks the end of the stack
 			// but we don't want to have to rely on that.
 			// Just skip it.
 			continue
 		}
-		if strings.HasPrefix(line, "...") && strings.HasSuffix(line, " frames elided...") {
+		if line[0] == '\t' {
+			// An indented line that doesn't follow a function, e.g.
+			//
+			//	<tab>goroutine running on other thread; stack unavailable
+			//
+			// It doesn't name a function, so skip it.
+			continue
+		}
+		if isElided(line) {
 			// e.g. ...23 frames elided...
 			// This indicates frames were elided from the stack trace,
 			// attempting to parse them via parseFuncName will fail resulting in a panic
@@ -179,17 +519,13 @@ func (p *stackParser) parseStack(line string) (Stack, error) {
 		if err != nil {
 			return Stack{}, fmt.Errorf("parse function: %w", err)
 		}
-		if !creator {
+		if !creator && firstFunction == "" {
 			// A function is part of a goroutine's stack
 			// only if it's not a "created by" function.
 			//
 			// The creator function is part of a different stack.
 			// We don't care about it right now.
-			funcs[funcName] = struct{}{}
-			if firstFunction == "" {
-				firstFunction = funcName
-			}
-
+			firstFunction = funcName
 		}
 
 		// The function name followed by a line in the form:
@@ -197,17 +533,17 @@ func (p *stackParser) parseStack(line string) (Stack, error) {
 		//	<tab>example.com/path/to/package/file.go:123 +0x123
 		//
 		// We don't care about the position so we can skip this line.
+		// The exception is the position of the "created by" line,
+		// which is where the goroutine was started.
 		if p.scan.Scan() {
 			// Be defensive:
 			// Skip the line only if it starts with a tab.
-			bs := p.scan.Bytes()
-			if len(bs) > 0 && bs[0] == '\t' {
-				fullStack.Write(bs)
-				fullStack.WriteByte('\n')
-			} else {
+			if line := p.scan.Text(); len(line) == 0 || line[0] != '\t' {
 				// Put it back and let the next iteration handle it
 				// if it doesn't start with a tab.
 				p.scan.Unscan()
+			} else if creator {
+				createdFile, createdLine = parsePosition(line)
 			}
 		}
 
@@ -216,40 +552,97 @@ func (p *stackParser) parseStack(line string) (Stack, error) {
 			// We can stop parsing now.
 			//
 			// Note that if tracebackancestors=N is set,
-			// there may be more a traceback of the creator function
+			// there may be tracebacks of the ancestor goroutines
 			// following the "created by" line,
-			// but it should not be considered part of this stack.
-			// e.g.,
-			//
-			// created by testing.(*T).Run in goroutine 1
-			//         /usr/lib/go/src/testing/testing.go:1648 +0x3ad
-			// [originating from goroutine 1]:
-			// testing.(*T).Run(...)
-			//         /usr/lib/go/src/testing/testing.go:1649 +0x3ad
-			//
+			// but they should not be considered part of this stack.
+			// See parseAncestors.
 			createdBy = funcName
+			parentID = parseParentID(line)
 			break
 		}
 	}
 
 	return Stack{
-		id:            id,
-		state:         state,
 		createdBy:     createdBy,
+		createdFile:   createdFile,
+		createdLine:   createdLine,
+		parentID:      parentID,
 		firstFunction: firstFunction,
-		allFunctions:  funcs,
-		fullStack:     fullStack.String(),
+		allFunctions:  new(funcSet),
+		fullStack:     p.trace[start:p.scan.Offset()],
 	}, nil
 }
 
+// isElided reports whether the line indicates that frames were elided
+// from a stack trace because it's too deep, e.g.
+//
+//	...23 frames elided...
+func isElided(line string) bool {
+	return strings.HasPrefix(line, "...") && strings.HasSuffix(line, " frames elided...")
+}
+
+// parseAncestors parses the tracebacks of ancestor goroutines
+// that follow a stack trace if GODEBUG=tracebackancestors=N is set.
+// They look like:
+//
+//	created by testing.(*T).Run in goroutine 1
+//	        /usr/lib/go/src/testing/testing.go:1648 +0x3ad
+//	[originating from goroutine 1]:
+//	testing.(*T).Run(...)
+//	        /usr/lib/go/src/testing/testing.go:1649 +0x3ad
+//
+// The ancestors are returned starting with the parent goroutine.
+func (p *stackParser) parseAncestors() ([]Stack, error) {
+	var ancestors []Stack
+	for p.scan.Scan() {
+		line := p.scan.Text()
+		idStr, ok := strings.CutPrefix(line, _ancestorPrefix)
+		if !ok {
+			p.scan.Unscan()
+			break
+		}
+
+		id, err := strconv.Atoi(strings.TrimSuffix(idStr, "]:"))
+		if err != nil {
+			return nil, fmt.Errorf("bad goroutine ID %q in line %q", idStr, line)
+		}
+
+		ancestor, err := p.parseFrames()
+		if err != nil {
+			return nil, err
+		}
+		ancestor.id = id
+		ancestors = append(ancestors, ancestor)
+	}
+
+	// Each ancestor was created by the next one.
+	for i := 0; i+1 < len(ancestors); i++ {
+		if ancestors[i].parentID == 0 {
+			ancestors[i].parentID = ancestors[i+1].id
+		}
+	}
+	return ancestors, nil
+}
+
 // All returns the stacks for all running goroutines.
 func All() []Stack {
-	return getStacks(true)
+	return getStacks(true, nil, nil)
+}
+
+// Filter returns the stacks for running goroutines
+// for which keep returns true.
+//
+// This is cheaper than filtering the result of All
+// if there are many goroutines and most of them are filtered out:
+// stacks are parsed and passed to keep one at a time,
+// and only the stack traces of kept goroutines are copied.
+func Filter(keep func(Stack) bool) []Stack {
+	return getStacks(true, nil, keep)
 }
 
 // Current returns the stack for the current goroutine.
 func Current() Stack {
-	return getStacks(false)[0]
+	return getStacks(false, nil, nil)[0]
 }
 
 func getStackBuffer(all bool) []byte {
@@ -292,25 +685,120 @@ func parseFuncName(line string) (name string, creator bool, err error) {
 	return name, creator, nil
 }
 
+// parsePosition parses the file and line
+// from the position of a function that looks like:
+//
+//	<tab>/path/to/file.go:123 +0x123
+//
+// The offset is missing for inlined functions,
+// and with GOTRACEBACK=system or higher, it's followed by more fields.
+// It returns an empty file and 0 if the position can't be parsed.
+func parsePosition(line string) (file string, lineNo int) {
+	// The file name may contain spaces, so only cut at the offset.
+	pos, _, _ := strings.Cut(strings.TrimPrefix(line, "\t"), " +0x")
+	idx := strings.LastIndexByte(pos, ':')
+	if idx < 0 {
+		return "", 0
+	}
+	lineNo, err := strconv.Atoi(pos[idx+1:])
+	if err != nil {
+		return "", 0
+	}
+	return pos[:idx], lineNo
+}
+
+// parseParentID parses the ID of the parent goroutine
+// from a "created by" line that looks like:
+//
+//	created by example.com/path/to/package.funcName in goroutine 123
+//
+// It returns 0 if the line doesn't include the parent goroutine,
+// as is the case before Go 1.21.
+func parseParentID(line string) int {
+	idx := strings.LastIndex(line, " in goroutine ")
+	if idx < 0 {
+		return 0
+	}
+	id, err := strconv.Atoi(line[idx+len(" in goroutine "):])
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// funcPackage returns the import path of the package
+// that the given fully qualified function belongs to.
+// For example, for all of the following,
+//
+//	example.com/path/to/package.funcName
+//	example.com/path/to/package.(*typeName).funcName
+//	example.com/path/to/package.funcName.func1
+//
+// it returns "example.com/path/to/package".
+func funcPackage(name string) string {
+	// The package name cannot have a '.' after the last '/',
+	// but the path before it may, e.g. "example.com/".
+	start := strings.LastIndexByte(name, '/') + 1
+	if idx := strings.IndexByte(name[start:], '.'); idx >= 0 {
+		return name[:start+idx]
+	}
+	return name
+}
+
+// InPackageTree reports whether the given fully qualified function
+// belongs to the package with the given import path,
+// or to a package whose import path starts with root followed by "/".
+// For example, "example.com/foo/bar.baz" is in the tree of
+// both "example.com/foo" and "example.com/foo/bar",
+// but not "example.com/fo".
+func InPackageTree(fn, root string) bool {
+	if fn == "" || root == "" {
+		return false
+	}
+	return funcPackage(fn) == escapePackage(root) || strings.HasPrefix(fn, root+"/")
+}
+
+// escapePackage escapes an import path the same way
+// the linker does in symbol names:
+// dots in the last element of the path are replaced with "%2e".
+// For example, "gopkg.in/yaml.v3" becomes "gopkg.in/yaml%2ev3".
+func escapePackage(pkg string) string {
+	start := strings.LastIndexByte(pkg, '/') + 1
+	return pkg[:start] + strings.ReplaceAll(pkg[start:], ".", "%2e")
+}
+
 // parseGoStackHeader parses a stack header that looks like:
 // goroutine 643 [runnable]:\n
 // And returns the goroutine ID, and the state.
+//
+// With GOTRACEBACK=system or higher,
+// the header has extra fields before the state, e.g.:
+//
+//	goroutine 643 gp=0xc000102000 m=nil [runnable]:
+//
+// These are ignored.
 func parseGoStackHeader(line string) (goroutineID int, state string, err error) {
 	// The scanner will have already trimmed the "\n",
 	// but we'll guard against it just in case.
 	//
 	// Trimming them separately makes them both optional.
 	line = strings.TrimSuffix(strings.TrimSuffix(line, ":"), "\n")
-	parts := strings.SplitN(line, " ", 3)
-	if len(parts) != 3 {
+	idStr, rest, ok := strings.Cut(strings.TrimPrefix(line, "goroutine "), " ")
+	if !ok {
 		return 0, "", fmt.Errorf("unexpected format: %q", line)
 	}
 
-	id, err := strconv.Atoi(parts[1])
+	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		return 0, "", fmt.Errorf("bad goroutine ID %q in line %q", parts[1], line)
+		return 0, "", fmt.Errorf("bad goroutine ID %q in line %q", idStr, line)
 	}
 
-	state = strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
-	return id, state, nil
+	// Any extra fields come before the state,
+	// and the state may contain spaces, e.g. "chan receive, 5 minutes".
+	start := strings.IndexByte(rest, '[')
+	end := strings.LastIndexByte(rest, ']')
+	if start < 0 || end < start {
+		return 0, "", fmt.Errorf("missing state in line %q", line)
+	}
+	return id, rest[start+1 : end], nil
 }
@@ -21,7 +21,6 @@
 package stack
 
 import (
-	"bytes"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -29,6 +28,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -71,16 +71,124 @@ func TestAll(t *testing.T) {
 	sort.Sort(byGoroutineID(got))
 
 	assert.Contains(t, got[0].Full(), "testing.(*T).Run")
-	assert.Contains(t, got[0].allFunctions, "testing.(*T).Run")
+	assert.True(t, got[0].HasFunction("testing.(*T).Run"))
 
 	assert.Contains(t, got[1].Full(), "TestAll")
-	assert.Contains(t, got[1].allFunctions, "go.uber.org/goleak/internal/stack.TestAll")
+	assert.True(t, got[1].HasFunction("go.uber.org/goleak/internal/stack.TestAll"))
 
 	for i := 0; i < 5; i++ {
 		assert.Contains(t, got[2+i].Full(), "stack.waitForDone")
 	}
 }
 
+func waitForFilterDone(done <-chan struct{}) {
+	<-done
+}
+
+func TestFilter(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	var started sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		started.Add(1)
+		go func() {
+			started.Done()
+			waitForFilterDone(done)
+		}()
+	}
+	started.Wait()
+
+	const waitFn = "go.uber.org/goleak/internal/stack.waitForFilterDone"
+	var got []Stack
+	for retry := 0; retry < 100; retry++ {
+		got = Filter(func(s Stack) bool {
+			return s.HasFunction(waitFn)
+		})
+		if len(got) == 3 {
+			break
+		}
+		runtime.Gosched()
+	}
+	require.Len(t, got, 3)
+
+	for _, s := range got {
+		assert.True(t, s.HasFunction(waitFn), "kept stacks should be usable")
+		assert.Equal(t, waitFn, s.FirstFunction())
+		assert.Contains(t, s.Full(), "stacks_test.go")
+	}
+}
+
+func TestDetach(t *testing.T) {
+	stacks, err := newStackParser(joinLines(
+		"goroutine 2 [chan receive]:",
+		"example.com/foo/bar.baz()",
+		"	example.com/foo/bar.go:123",
+		"created by example.com/foo/bar.qux in goroutine 1",
+		"	example.com/foo/bar.go:456",
+		"[originating from goroutine 1]:",
+		"example.com/foo/bar.qux(...)",
+		"	example.com/foo/bar.go:456",
+	)).Parse()
+	require.NoError(t, err)
+	require.Len(t, stacks, 1)
+
+	orig := stacks[0]
+	assert.True(t, orig.HasFunction("example.com/foo/bar.baz"))
+
+	s := orig.detach()
+	assert.Equal(t, orig.ID(), s.ID())
+	assert.Equal(t, orig.State(), s.State())
+	assert.Equal(t, orig.FirstFunction(), s.FirstFunction())
+	assert.Equal(t, orig.CreatedBy(), s.CreatedBy())
+	assert.Equal(t, orig.Full(), s.Full())
+	assert.True(t, s.HasFunction("example.com/foo/bar.baz"))
+	assert.NotSame(t, orig.allFunctions, s.allFunctions,
+		"function set should be rebuilt from the copy")
+
+	require.Len(t, s.Ancestors(), 1)
+	assert.Equal(t, orig.Ancestors()[0].Full(), s.Ancestors()[0].Full())
+	assert.True(t, s.Ancestors()[0].HasFunction("example.com/foo/bar.qux"))
+}
+
+func BenchmarkAll(b *testing.B) {
+	benchmarkGoroutines(b, func() {
+		All()
+	})
+}
+
+func BenchmarkFilter(b *testing.B) {
+	benchmarkGoroutines(b, func() {
+		Filter(func(s Stack) bool {
+			return !s.HasFunction("go.uber.org/goleak/internal/stack.waitForFilterDone")
+		})
+	})
+}
+
+// benchmarkGoroutines runs fn with many blocked goroutines.
+func benchmarkGoroutines(b *testing.B, fn func()) {
+	const numGoroutines = 10000
+
+	done := make(chan struct{})
+	defer close(done)
+
+	var started sync.WaitGroup
+	started.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			started.Done()
+			waitForFilterDone(done)
+		}()
+	}
+	started.Wait()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fn()
+	}
+}
+
 func TestCurrent(t *testing.T) {
 	const pkgPrefix = "go.uber.org/goleak/internal/stack"
 
@@ -118,6 +226,7 @@ func TestCurrent(t *testing.T) {
 func TestCurrentCreatedBy(t *testing.T) {
 	var stack Stack
 	done := make(chan struct{})
+	_, _, goLine, _ := runtime.Caller(0)
 	go func() {
 		defer close(done)
 		stack = Current()
@@ -133,6 +242,16 @@ func TestCurrentCreatedBy(t *testing.T) {
 	assert.True(t,
 		stack.HasFunction("go.uber.org/goleak/internal/stack.TestCurrentCreatedBy.func1"),
 		"TestCurrentCreatedBy.func1 is not in stack:\n%s", stack.Full())
+
+	file, line := stack.CreatedAt()
+	assert.Equal(t, "stacks_test.go", filepath.Base(file))
+	assert.Equal(t, goLine+1, line, "should be created by the go statement")
+
+	// Go 1.21 added the parent goroutine to the "created by" line.
+	if strings.Contains(stack.Full(), " in goroutine ") {
+		assert.Equal(t, Current().ID(), stack.ParentID(),
+			"parent should be the test goroutine")
+	}
 }
 
 func TestAllLargeStack(t *testing.T) {
@@ -169,7 +288,7 @@ func TestAllLargeStack(t *testing.T) {
 	// At the time of writing this test, with a stack depth of 101, we get 2 elided frames:
 	// "...2 frames elided...".
 	assert.Contains(t, string(buf), "frames elided...")
-	stacks, err := newStackParser(bytes.NewReader(buf)).Parse()
+	stacks, err := newStackParser(string(buf)).Parse()
 	require.NoError(t, err)
 	assert.Greater(t, len(stacks), numGoroutines, "expect more parsed stacks than goroutines")
 
@@ -218,17 +337,140 @@ func TestParseFuncName(t *testing.T) {
 	}
 }
 
+func TestFuncPackage(t *testing.T) {
+	tests := []struct {
+		give string
+		want string
+	}{
+		{"main.main", "main"},
+		{"net/http.Serve", "net/http"},
+		{"net/http.(*persistConn).readLoop", "net/http"},
+		{"example.com/foo/bar.baz.func1", "example.com/foo/bar"},
+		{"example.com/foo.v2/bar.(*baz).qux", "example.com/foo.v2/bar"},
+		{"gopkg.in/yaml%2ev3.Unmarshal", "gopkg.in/yaml%2ev3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.give, func(t *testing.T) {
+			assert.Equal(t, tt.want, funcPackage(tt.give))
+		})
+	}
+}
+
+func TestParsePosition(t *testing.T) {
+	tests := []struct {
+		give     string
+		wantFile string
+		wantLine int
+	}{
+		{"\t/path/to/file.go:123 +0x1d", "/path/to/file.go", 123},
+		{"\t/path/to/file.go:89", "/path/to/file.go", 89},
+		{"\t/path/to/file.go:474 +0xca fp=0xc00007ef70 sp=0xc00007ef50 pc=0x471c2e", "/path/to/file.go", 474},
+		{"\t/path/with space/file.go:12 +0x1", "/path/with space/file.go", 12},
+		{"\tC:/path/to/file.go:12 +0x1", "C:/path/to/file.go", 12},
+		{"\t/path/to/file.go", "", 0},
+		{"\t/path/to/file.go:abc", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.give, func(t *testing.T) {
+			file, line := parsePosition(tt.give)
+			assert.Equal(t, tt.wantFile, file)
+			assert.Equal(t, tt.wantLine, line)
+		})
+	}
+}
+
+func TestEscapePackage(t *testing.T) {
+	assert.Equal(t, "main", escapePackage("main"))
+	assert.Equal(t, "net/http", escapePackage("net/http"))
+	assert.Equal(t, "gopkg.in/yaml%2ev3", escapePackage("gopkg.in/yaml.v3"))
+	assert.Equal(t, "example.com/foo.v2/bar", escapePackage("example.com/foo.v2/bar"))
+}
+
+func TestInPackageTree(t *testing.T) {
+	tests := []struct {
+		fn   string
+		root string
+		want bool
+	}{
+		{"example.com/foo.bar", "example.com/foo", true},
+		{"example.com/foo.(*T).bar", "example.com/foo", true},
+		{"example.com/foo/bar.baz", "example.com/foo", true},
+		{"example.com/foo/bar/baz.qux.func1", "example.com/foo", true},
+		{"example.com/foo/bar.baz", "example.com/foo/bar", true},
+		{"example.com/foobar.baz", "example.com/foo", false},
+		{"example.com/foo.bar", "example.com/foo/bar", false},
+		{"example.com/fo.bar", "example.com/foo", false},
+		{"gopkg.in/yaml%2ev3.Unmarshal", "gopkg.in/yaml.v3", true},
+		{"gopkg.in/yaml.v3/sub.F", "gopkg.in/yaml.v3", true},
+		{"net/http.(*Server).Serve", "net", true},
+		{"main.main", "main", true},
+		{"", "example.com/foo", false},
+		{"example.com/foo.bar", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fn+" in "+tt.root, func(t *testing.T) {
+			assert.Equal(t, tt.want, InPackageTree(tt.fn, tt.root))
+		})
+	}
+}
+
 func TestParseStack(t *testing.T) {
 	tests := []struct {
 		name string
 		give string
 
-		id        int
-		state     string
-		createdBy string
-		firstFunc string
-		funcs     []string
+		id          int
+		state       string
+		createdBy   string
+		createdFile string
+		createdLine int
+		parentID    int
+		firstFunc   string
+		funcs       []string
 	}{
+		{
+			name: "system header",
+			give: joinLines(
+				"goroutine 7 gp=0xc000007a40 m=nil [chan receive, 2 minutes]:",
+				"runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)",
+				"	/usr/lib/go/src/runtime/proc.go:424 +0xce fp=0xc00007ef70 sp=0xc00007ef50 pc=0x471c2e",
+				"example.com/foo/bar.baz()",
+				"	example.com/foo/bar.go:123 +0x1d fp=0xc00007efe0 sp=0xc00007ef70 pc=0x4a1b3d",
+				"runtime.goexit({})",
+				"	/usr/lib/go/src/runtime/asm_amd64.s:1700 +0x1 fp=0xc00007efe8 sp=0xc00007efe0 pc=0x478ec1",
+				"created by example.com/foo/bar.qux in goroutine 1",
+				"	example.com/foo/bar.go:456 +0x1a",
+			),
+			id:          7,
+			state:       "chan receive, 2 minutes",
+			createdBy:   "example.com/foo/bar.qux",
+			createdFile: "example.com/foo/bar.go",
+			createdLine: 456,
+			parentID:    1,
+			firstFunc:   "runtime.gopark",
+			funcs: []string{
+				"runtime.gopark",
+				"example.com/foo/bar.baz",
+				"runtime.goexit",
+			},
+		},
+		{
+			name: "running on other thread",
+			give: joinLines(
+				"goroutine 12 gp=0xc000102000 m=3 mp=0xc000080008 [running]:",
+				"	goroutine running on other thread; stack unavailable",
+				"created by example.com/foo/bar.qux in goroutine 1",
+				"	example.com/foo/bar.go:456 +0x1a",
+			),
+			id:          12,
+			state:       "running",
+			createdBy:   "example.com/foo/bar.qux",
+			createdFile: "example.com/foo/bar.go",
+			createdLine: 456,
+			parentID:    1,
+		},
 		{
 			name: "running",
 			give: joinLines(
@@ -267,10 +509,32 @@ func TestParseStack(t *testing.T) {
 				"created by example.com/foo/bar.qux",
 				"	example.com/foo/bar.go:456",
 			),
-			id:        1,
-			state:     "running",
-			createdBy: "example.com/foo/bar.qux",
-			firstFunc: "example.com/foo/bar.baz",
+			id:          1,
+			state:       "running",
+			createdBy:   "example.com/foo/bar.qux",
+			createdFile: "example.com/foo/bar.go",
+			createdLine: 456,
+			firstFunc:   "example.com/foo/bar.baz",
+			funcs: []string{
+				"example.com/foo/bar.baz",
+			},
+		},
+		{
+			name: "created by/in goroutine",
+			give: joinLines(
+				"goroutine 2 [running]:",
+				"example.com/foo/bar.baz()",
+				"	example.com/foo/bar.go:123",
+				"created by example.com/foo/bar.qux in goroutine 1",
+				"	example.com/foo/bar.go:456",
+			),
+			id:          2,
+			state:       "running",
+			createdBy:   "example.com/foo/bar.qux",
+			createdFile: "example.com/foo/bar.go",
+			createdLine: 456,
+			parentID:    1,
+			firstFunc:   "example.com/foo/bar.baz",
 			funcs: []string{
 				"example.com/foo/bar.baz",
 			},
@@ -285,10 +549,12 @@ func TestParseStack(t *testing.T) {
 				"created by example.com/foo/bar.qux",
 				"	example.com/foo/bar.go:456",
 			),
-			id:        1,
-			state:     "running",
-			createdBy: "example.com/foo/bar.qux",
-			firstFunc: "example.com/foo/bar.baz",
+			id:          1,
+			state:       "running",
+			createdBy:   "example.com/foo/bar.qux",
+			createdFile: "example.com/foo/bar.go",
+			createdLine: 456,
+			firstFunc:   "example.com/foo/bar.baz",
 			funcs: []string{
 				"example.com/foo/bar.baz",
 			},
@@ -297,7 +563,7 @@ func TestParseStack(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			stacks, err := newStackParser(strings.NewReader(tt.give)).Parse()
+			stacks, err := newStackParser(tt.give).Parse()
 			require.NoError(t, err)
 			require.Len(t, stacks, 1)
 
@@ -305,15 +571,71 @@ func TestParseStack(t *testing.T) {
 			assert.Equal(t, tt.id, stack.ID())
 			assert.Equal(t, tt.state, stack.State())
 			assert.Equal(t, tt.createdBy, stack.CreatedBy())
+			file, line := stack.CreatedAt()
+			assert.Equal(t, tt.createdFile, file)
+			assert.Equal(t, tt.createdLine, line)
+			assert.Equal(t, tt.parentID, stack.ParentID())
 			assert.Equal(t, tt.firstFunc, stack.FirstFunction())
 			for _, fn := range tt.funcs {
 				assert.True(t, stack.HasFunction(fn),
 					"missing in stack: %v\n%s", fn, stack.Full())
+				assert.True(t, stack.HasCanonicalFunction(CanonicalFunction(fn)),
+					"missing canonical in stack: %v\n%s", fn, stack.Full())
 			}
 		})
 	}
 }
 
+func TestParseAncestors(t *testing.T) {
+	stacks, err := newStackParser(joinLines(
+		"goroutine 3 [chan receive]:",
+		"example.com/foo/bar.baz()",
+		"	example.com/foo/bar.go:123",
+		"created by example.com/foo/bar.qux in goroutine 2",
+		"	example.com/foo/bar.go:456",
+		"[originating from goroutine 2]:",
+		"example.com/foo/bar.qux(...)",
+		"	example.com/foo/bar.go:457",
+		"example.com/foo/bar.quux(...)",
+		"	example.com/foo/bar.go:500",
+		"created by example.com/foo/bar.main",
+		"	example.com/foo/bar.go:600",
+		"[originating from goroutine 1]:",
+		"example.com/foo/bar.main(...)",
+		"	example.com/foo/bar.go:601",
+		"",
+		"goroutine 4 [running]:",
+		"example.com/foo/bar.baz()",
+		"	example.com/foo/bar.go:123",
+	)).Parse()
+	require.NoError(t, err)
+	require.Len(t, stacks, 2)
+
+	stack := stacks[0]
+	assert.Equal(t, 2, stack.ParentID())
+	assert.Equal(t, "example.com/foo/bar.qux", stack.CreatedBy())
+	assert.False(t, stack.HasFunction("example.com/foo/bar.quux"),
+		"ancestor functions should not be part of the stack")
+	assert.NotContains(t, stack.Full(), "originating from")
+	assert.Contains(t, stack.String(), "Originating from goroutine 2:")
+
+	ancestors := stack.Ancestors()
+	require.Len(t, ancestors, 2)
+
+	assert.Equal(t, 2, ancestors[0].ID())
+	assert.Equal(t, 1, ancestors[0].ParentID())
+	assert.Equal(t, "example.com/foo/bar.qux", ancestors[0].FirstFunction())
+	assert.Equal(t, "example.com/foo/bar.main", ancestors[0].CreatedBy())
+	assert.True(t, ancestors[0].HasFunction("example.com/foo/bar.quux"))
+
+	assert.Equal(t, 1, ancestors[1].ID())
+	assert.Equal(t, 0, ancestors[1].ParentID())
+	assert.Equal(t, "example.com/foo/bar.main", ancestors[1].FirstFunction())
+
+	assert.Equal(t, 4, stacks[1].ID())
+	assert.Empty(t, stacks[1].Ancestors())
+}
+
 func TestParseStackErrors(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -330,6 +652,23 @@ func TestParseStackErrors(t *testing.T) {
 			give:    "goroutine [running]:",
 			wantErr: `unexpected format`,
 		},
+		{
+			name:    "missing state",
+			give:    "goroutine 1 gp=0xc000102000 m=nil:",
+			wantErr: `missing state`,
+		},
+		{
+			name: "bad ancestor ID",
+			give: joinLines(
+				"goroutine 2 [running]:",
+				"example.com/foo/bar.baz()",
+				"	example.com/foo/bar.go:123",
+				"created by example.com/foo/bar.qux",
+				"	example.com/foo/bar.go:456",
+				"[originating from goroutine x]:",
+			),
+			wantErr: `bad goroutine ID "x]:"`,
+		},
 		{
 			name: "bad function name",
 			give: joinLines(
@@ -343,13 +682,68 @@ func TestParseStackErrors(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := newStackParser(strings.NewReader(tt.give)).Parse()
+			_, err := newStackParser(tt.give).Parse()
 			require.Error(t, err)
 			assert.ErrorContains(t, err, tt.wantErr)
 		})
 	}
 }
 
+func TestParseStackTolerant(t *testing.T) {
+	give := joinLines(
+		"goroutine 1 [running]:",
+		"example.com/foo/bar.baz()",
+		"	example.com/foo/bar.go:123",
+		"",
+		"goroutine 2 [chan receive]:",
+		"example.com/foo/bar.baz", // no arguments
+		"	example.com/foo/bar.go:123",
+		"created by example.com/foo/bar.qux in goroutine 1",
+		"	example.com/foo/bar.go:456",
+		"",
+		"goroutine x [select]:",
+		"example.com/foo/bar.baz()",
+		"",
+		"goroutine 4 [select]:",
+		"example.com/foo/bar.qux()",
+		"	example.com/foo/bar.go:456",
+	)
+
+	_, err := newStackParser(give).Parse()
+	require.Error(t, err, "strict mode should fail")
+
+	stacks, err := Parse(strings.NewReader(give))
+	require.NoError(t, err)
+	require.Len(t, stacks, 4)
+
+	assert.NoError(t, stacks[0].ParseError())
+	assert.Equal(t, "example.com/foo/bar.baz", stacks[0].FirstFunction())
+
+	assert.ErrorContains(t, stacks[1].ParseError(), "no function found")
+	assert.Equal(t, 2, stacks[1].ID())
+	assert.Equal(t, "chan receive", stacks[1].State())
+	assert.Empty(t, stacks[1].FirstFunction())
+	assert.Equal(t, joinLines(
+		"example.com/foo/bar.baz",
+		"	example.com/foo/bar.go:123",
+		"created by example.com/foo/bar.qux in goroutine 1",
+		"	example.com/foo/bar.go:456",
+		"",
+	), stacks[1].Full())
+	assert.Contains(t, stacks[1].String(), "failed to parse")
+
+	assert.ErrorContains(t, stacks[2].ParseError(), "bad goroutine ID")
+	assert.Zero(t, stacks[2].ID())
+	assert.Equal(t, joinLines(
+		"example.com/foo/bar.baz()",
+		"",
+	), stacks[2].Full())
+
+	assert.NoError(t, stacks[3].ParseError())
+	assert.Equal(t, 4, stacks[3].ID())
+	assert.Equal(t, "example.com/foo/bar.qux", stacks[3].FirstFunction())
+}
+
 func TestParseStackFixtures(t *testing.T) {
 	type goroutine struct {
 		// ID must match the goroutine ID in the fixture.
@@ -361,12 +755,66 @@ func TestParseStackFixtures(t *testing.T) {
 
 		HasFunctions    []string // non-exhaustive, in any order
 		NotHasFunctions []string
+
+		ParentID    int
+		AncestorIDs []int
+	}
+
+	// GOTRACEBACK=system and crash print the same stacks
+	// with extra fields and runtime frames.
+	gotracebackSystem := []goroutine{
+		{
+			ID:            1,
+			State:         "running",
+			FirstFunction: "panic",
+			HasFunctions:  []string{"main.main", "runtime.main", "runtime.goexit"},
+		},
+		{ID: 2, State: "force gc (idle)", FirstFunction: "runtime.gopark", ParentID: 1},
+		{ID: 3, State: "GC sweep wait", FirstFunction: "runtime.gopark", ParentID: 1},
+		{ID: 4, State: "GC scavenge wait", FirstFunction: "runtime.gopark", ParentID: 1},
+		{ID: 5, State: "finalizer wait", FirstFunction: "runtime.gopark", ParentID: 1},
+		{ID: 6, State: "cleanup wait", FirstFunction: "runtime.gopark", ParentID: 1},
+		{
+			ID:            7,
+			State:         "IO wait",
+			FirstFunction: "runtime.gopark",
+			HasFunctions: []string{
+				"internal/poll.runtime_pollWait",
+				"net/http.Serve",
+				"runtime.goexit",
+			},
+			NotHasFunctions: []string{"main.start"},
+			ParentID:        1,
+		},
+		{
+			ID:            10,
+			State:         "IO wait",
+			FirstFunction: "runtime.gopark",
+			HasFunctions:  []string{"net/http.(*conn).serve"},
+			ParentID:      7,
+		},
+		{
+			ID:            11,
+			State:         "select",
+			FirstFunction: "runtime.gopark",
+			HasFunctions:  []string{"net/http.(*persistConn).readLoop"},
+			ParentID:      8,
+		},
+		{
+			ID:            12,
+			State:         "select",
+			FirstFunction: "runtime.gopark",
+			HasFunctions:  []string{"net/http.(*persistConn).writeLoop"},
+			ParentID:      8,
+		},
 	}
 
 	tests := []struct {
 		name   string      // file name inside testdata
 		stacks []goroutine // in any order
 	}{
+		{name: "http.gotraceback-system.txt", stacks: gotracebackSystem},
+		{name: "http.gotraceback-crash.txt", stacks: gotracebackSystem},
 		{
 			name: "http.txt",
 			stacks: []goroutine{
@@ -484,6 +932,8 @@ func TestParseStackFixtures(t *testing.T) {
 					ID:            24,
 					State:         "select",
 					FirstFunction: "net/http.(*persistConn).readLoop",
+					ParentID:      21,
+					AncestorIDs:   []int{21, 1},
 					NotHasFunctions: []string{
 						"net/http.(*Transport).dialConn", // created by
 						// tracebackancestors:
@@ -530,13 +980,10 @@ func TestParseStackFixtures(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			fixture, err := os.Open(filepath.Join("testdata", tt.name))
+			fixture, err := os.ReadFile(filepath.Join("testdata", tt.name))
 			require.NoError(t, err)
-			defer func() {
-				assert.NoError(t, fixture.Close())
-			}()
 
-			stacks, err := newStackParser(fixture).Parse()
+			stacks, err := newStackParser(string(fixture)).Parse()
 			require.NoError(t, err)
 
 			stacksByID := make(map[int]Stack, len(stacks))
@@ -553,6 +1000,16 @@ func TestParseStackFixtures(t *testing.T) {
 
 				assert.Equal(t, wantStack.State, gotStack.State())
 				assert.Equal(t, wantStack.FirstFunction, gotStack.FirstFunction())
+				if wantStack.ParentID != 0 {
+					assert.Equal(t, wantStack.ParentID, gotStack.ParentID())
+				}
+				if wantStack.AncestorIDs != nil {
+					var ancestorIDs []int
+					for _, a := range gotStack.Ancestors() {
+						ancestorIDs = append(ancestorIDs, a.ID())
+					}
+					assert.Equal(t, wantStack.AncestorIDs, ancestorIDs)
+				}
 
 				for _, fn := range wantStack.HasFunctions {
 					assert.True(t, gotStack.HasFunction(fn), "missing in stack: %v\n%s", fn, gotStack.Full())
@@ -595,3 +1052,67 @@ func isBackgroundRunning(cur Stack, stacks []Stack) bool {
 
 	return false
 }
+
+func TestHasPosition(t *testing.T) {
+	stacks, err := Parse(strings.NewReader(joinLines(
+		"goroutine 2 [chan receive]:",
+		"example.com/foo/bar.baz()",
+		"	/path/to/example.com/foo/bar.go:123 +0x1d",
+		"example.com/foo/bar.qux()",
+		"	/path/to/example.com/foo/qux.go:45 +0x2e",
+		"created by example.com/foo/bar.start in goroutine 1",
+		"	/path/to/example.com/foo/start.go:67 +0x3f",
+	)))
+	require.NoError(t, err)
+	require.Len(t, stacks, 1)
+	s := stacks[0]
+
+	at := func(file string, line int) func(string, int) bool {
+		return func(f string, l int) bool {
+			return f == file && l == line
+		}
+	}
+	assert.True(t, s.HasPosition(at("/path/to/example.com/foo/bar.go", 123)))
+	assert.True(t, s.HasPosition(at("/path/to/example.com/foo/qux.go", 45)))
+	assert.False(t, s.HasPosition(at("/path/to/example.com/foo/bar.go", 45)))
+	assert.False(t, s.HasPosition(at("/path/to/example.com/foo/start.go", 67)),
+		"creator position is not a frame")
+}
+
+func TestHasPackageUnder(t *testing.T) {
+	stacks, err := Parse(strings.NewReader(joinLines(
+		"goroutine 2 [chan receive]:",
+		"example.com/foo/bar.baz()",
+		"	/path/to/example.com/foo/bar.go:123 +0x1d",
+		"created by example.com/qux.start in goroutine 1",
+		"	/path/to/example.com/qux/start.go:67 +0x3f",
+	)))
+	require.NoError(t, err)
+	require.Len(t, stacks, 1)
+	s := stacks[0]
+
+	assert.True(t, s.HasPackageUnder("example.com/foo"))
+	assert.True(t, s.HasPackageUnder("example.com/foo/bar"))
+	assert.False(t, s.HasPackageUnder("example.com/foo/bar/baz"))
+	assert.False(t, s.HasPackageUnder("example.com/qux"), "creator is not on the stack")
+}
+
+func TestWaitDuration(t *testing.T) {
+	tests := []struct {
+		state string
+		want  time.Duration
+	}{
+		{"running", 0},
+		{"chan receive", 0},
+		{"chan receive, 5 minutes", 5 * time.Minute},
+		{"select, 1 minutes, locked to thread", time.Minute},
+		{"chan receive (nil chan), 30 minutes", 30 * time.Minute},
+		{"syscall, locked to thread", 0},
+		{"select, x minutes", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.state, func(t *testing.T) {
+			assert.Equal(t, tt.want, Stack{state: tt.state}.WaitDuration())
+		})
+	}
+}
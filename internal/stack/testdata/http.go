@@ -3,6 +3,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"net"
 	"net/http"
@@ -10,11 +11,19 @@ import (
 	"time"
 )
 
+var _crash = flag.Bool("crash", false,
+	"panic instead of printing stacks, so that the runtime prints them "+
+		"to stderr in the format for the GOTRACEBACK level")
+
 func main() {
+	flag.Parse()
 	if err := start(); err != nil {
 		panic(err)
 	}
 
+	if *_crash {
+		panic("crash")
+	}
 	fmt.Println(string(getStackBuffer()))
 }
 
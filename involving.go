@@ -0,0 +1,95 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"runtime/debug"
+	"strings"
+
+	"go.uber.org/goleak/internal/stack"
+)
+
+// OnlyInvolving limits leak reports to goroutines that involve
+// the packages with the given import paths or any packages below them,
+// e.g. a module path: goroutines with a function from one of them
+// anywhere in their stack, or that were started by a function from one of them,
+// directly or through their ancestors (see [Goroutine.Ancestors]).
+// Other goroutines, such as the internals of database drivers or SDKs,
+// aren't reported, only counted in a one-line summary
+// if there are other unexpected goroutines.
+// A trailing "/..." in a path is ignored.
+//
+//	goleak.VerifyNone(t, goleak.OnlyInvolving("github.com/ourorg/..."))
+//
+// With no paths, it defaults to the path of the main module,
+// as reported by [debug.ReadBuildInfo];
+// for tests, that's the module of the package under test.
+// If that's unknown, all goroutines are reported.
+func OnlyInvolving(paths ...string) Option {
+	if len(paths) == 0 {
+		paths = mainModule()
+	}
+	roots := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if p = strings.TrimSuffix(p, "/..."); p != "" {
+			roots = append(roots, p)
+		}
+	}
+	return optionFunc(func(opts *opts) {
+		opts.involving = append(opts.involving, roots...)
+	})
+}
+
+// mainModule returns the path of the main module, if known.
+func mainModule() []string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Path == "" {
+		return nil
+	}
+	return []string{info.Main.Path}
+}
+
+// involves reports whether the goroutine with the given stack
+// should be reported according to OnlyInvolving.
+// Goroutines that failed to parse are always reported,
+// since it can't be told what they involve.
+func (o *opts) involves(s stack.Stack) bool {
+	if len(o.involving) == 0 || s.ParseError() != nil {
+		return true
+	}
+	for _, root := range o.involving {
+		if involvesPackage(s, root) {
+			return true
+		}
+		for _, a := range s.Ancestors() {
+			if involvesPackage(a, root) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// involvesPackage reports whether the given stack or its creator
+// has a function from the package tree with the given root.
+func involvesPackage(s stack.Stack, root string) bool {
+	return stack.InPackageTree(s.CreatedBy(), root) || s.HasPackageUnder(root)
+}
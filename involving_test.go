@@ -0,0 +1,122 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/internal/stack"
+)
+
+func TestOnlyInvolving(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	tests := []struct {
+		name string
+		opt  Option
+		want bool // whether the goroutine is reported
+	}{
+		{"main module", OnlyInvolving(), true},
+		{"module", OnlyInvolving("go.uber.org/goleak"), true},
+		{"module pattern", OnlyInvolving("go.uber.org/goleak/..."), true},
+		{"parent", OnlyInvolving("go.uber.org"), true},
+		{"other", OnlyInvolving("example.com/ourorg/..."), false},
+		{"any of", OnlyInvolving("example.com/ourorg", "go.uber.org/goleak"), true},
+		{"subpackage", OnlyInvolving("go.uber.org/goleak/internal/stack"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Find(testOptions(), tt.opt)
+			if tt.want {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestOnlyInvolvingStacks(t *testing.T) {
+	stacks, err := stack.Parse(strings.NewReader(strings.Join([]string{
+		"goroutine 10 [chan receive]:",
+		"example.com/dep.wait()",
+		"	/path/to/example.com/dep/wait.go:10 +0x1d",
+		"example.com/ours/pkg.Run()",
+		"	/path/to/example.com/ours/pkg/run.go:20 +0x1d",
+		"created by example.com/dep.Start in goroutine 1",
+		"	/path/to/example.com/dep/start.go:30 +0x3f",
+		"",
+		"goroutine 11 [chan receive]:",
+		"example.com/dep.wait()",
+		"	/path/to/example.com/dep/wait.go:10 +0x1d",
+		"created by example.com/ours.Start in goroutine 1",
+		"	/path/to/example.com/ours/start.go:30 +0x3f",
+		"",
+		"goroutine 12 [chan receive]:",
+		"example.com/dep.wait()",
+		"	/path/to/example.com/dep/wait.go:10 +0x1d",
+		"created by example.com/dep.Start in goroutine 5",
+		"	/path/to/example.com/dep/start.go:30 +0x3f",
+		"[originating from goroutine 5]:",
+		"example.com/dep.Start()",
+		"	/path/to/example.com/dep/start.go:30 +0x3f",
+		"created by example.com/ours.Init in goroutine 1",
+		"	/path/to/example.com/ours/init.go:40 +0x3f",
+		"",
+		"goroutine 13 [chan receive]:",
+		"example.com/dep.wait()",
+		"	/path/to/example.com/dep/wait.go:10 +0x1d",
+		"created by example.com/dep.Start in goroutine 1",
+		"	/path/to/example.com/dep/start.go:30 +0x3f",
+		"",
+		"goroutine 14 [chan receive]:",
+		"example.com/ourselves.wait()",
+		"	/path/to/example.com/ourselves/wait.go:10 +0x1d",
+		"",
+		"goroutine 15 [chan receive]:",
+		"unparseable",
+		"",
+	}, "\n")))
+	require.NoError(t, err)
+	require.Len(t, stacks, 6)
+
+	var report filterReport
+	keep := buildOpts(OnlyInvolving("example.com/ours/...")).keepFunc(0, &report)
+	var kept []int
+	for _, s := range stacks {
+		if keep(s) {
+			kept = append(kept, s.ID())
+		}
+	}
+	assert.Equal(t, []int{10, 11, 12, 15}, kept)
+	assert.Equal(t, 2, report.dependencies)
+
+	msg := (&leakError{
+		stacks:       stacks[:1],
+		status:       "test",
+		dependencies: report.dependencies,
+	}).Error()
+	assert.Contains(t, msg, "]\n2 goroutines from dependencies suppressed\n")
+}
@@ -23,6 +23,9 @@ package goleak
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"go.uber.org/goleak/internal/stack"
 )
@@ -35,51 +38,274 @@ type TestingT interface {
 // filterStacks will filter any stacks excluded by the given opts.
 // filterStacks modifies the passed in stacks slice.
 func filterStacks(stacks []stack.Stack, skipID int, opts *opts) []stack.Stack {
+	return filterStacksWith(stacks, opts.keepFunc(skipID, nil), opts)
+}
+
+// filterStacksWith is a variant of filterStacks
+// that uses the given function to decide which stacks to keep,
+// in addition to ignoring descendants (see IgnoreDescendantsOf)
+// and companions (see companionFilter).
+func filterStacksWith(stacks []stack.Stack, keep func(stack.Stack) bool, opts *opts) []stack.Stack {
+	var byID map[int]stack.Stack
+	if len(opts.ancestors) > 0 {
+		byID = make(map[int]stack.Stack, len(stacks))
+		for _, s := range stacks {
+			byID[s.ID()] = s
+		}
+	}
+
+	companions := opts.ignoredCompanions(stacks)
+
 	filtered := stacks[:0]
 	for _, stack := range stacks {
-		// Always skip the running goroutine.
-		if stack.ID() == skipID {
+		if _, ok := companions[stack.ID()]; ok {
 			continue
 		}
-		// Run any default or user-specified filters.
-		if opts.filter(stack) {
-			continue
+		if keep(stack) && !opts.isDescendant(stack, byID) {
+			filtered = append(filtered, stack)
 		}
-		filtered = append(filtered, stack)
 	}
 	return filtered
 }
 
+// filteredStacks returns the stacks of running goroutines
+// other than the one with the given ID,
+// excluding any stacks excluded by the given opts.
+// It also reports the goroutines that were left out
+// but should be mentioned in a leak report.
+//
+// Stacks are filtered as they're parsed if possible,
+// which is much cheaper when there are many goroutines.
+func filteredStacks(skipID int, opts *opts) ([]stack.Stack, filterReport) {
+	var report filterReport
+	keep := opts.keepFunc(skipID, &report)
+	if len(opts.ancestors) > 0 || len(opts.companions) > 0 {
+		// Descendants and companions are identified by looking up
+		// other goroutines, including those that are filtered out.
+		return filterStacksWith(allStacks(), keep, opts), report
+	}
+	return filterAllStacks(keep), report
+}
+
 // Find looks for extra goroutines, and returns a descriptive error if
 // any are found.
 func Find(options ...Option) error {
 	cur := stack.Current().ID()
 
 	opts := buildOpts(options...)
+	if opts.disabled {
+		return nil
+	}
 	if opts.cleanup != nil {
 		return errors.New("Cleanup can only be passed to VerifyNone or VerifyTestMain")
 	}
 	if opts.runOnFailure {
 		return errors.New("RunOnFailure can only be passed to VerifyTestMain")
 	}
-	var stacks []stack.Stack
+	if err := opts.err(); err != nil {
+		return err
+	}
+
+	for _, hook := range opts.beforeCheck {
+		hook()
+	}
+	err := find(cur, opts)
+	for _, hook := range opts.afterCheck {
+		hook(err)
+	}
+
+	var lerr *leakError
+	if opts.warnOnly && errors.As(err, &lerr) {
+		opts.warn(fmt.Sprintf("goleak: found %d unexpected goroutines, not failing in warn-only mode: %v",
+			len(lerr.stacks), err))
+		return nil
+	}
+	return err
+}
+
+// find runs the leak check, retrying until there are no unexpected
+// goroutines other than the one with the given ID, or until it gives up.
+func find(cur int, opts *opts) error {
+	var (
+		stacks []stack.Stack
+		prev   []stack.Stack
+		report filterReport
+		exits  exitTracker
+
+		// Budgets exceeded in the latest sample.
+		exceeded []string
+
+		// Number of consecutive samples, ending with the latest one,
+		// that had the same set of unexpected goroutines.
+		unchanged int
+		attempts  int
+		settled   bool
+	)
 	retry := true
 	for i := 0; retry; i++ {
-		stacks = filterStacks(stack.All(), cur, opts)
+		stacks, report = filteredStacks(cur, opts)
+		stacks, exceeded = applyBudgets(stacks, opts)
+		exits.observe(time.Now(), stacks)
+		attempts++
 
 		if len(stacks) == 0 {
+			opts.warnSlowExits(exits.exited)
 			return nil
 		}
+
+		if prev != nil && sameStacks(prev, stacks) {
+			unchanged++
+		} else {
+			unchanged = 1
+		}
+		if opts.settleAfter > 0 && unchanged >= opts.settleAfter {
+			settled = true
+			break
+		}
+
+		prev = stacks
 		retry = opts.retry(i)
 	}
 
-	return fmt.Errorf("found unexpected goroutines:\n%s", stacks)
+	opts.warnSlowExits(exits.exited)
+	if len(opts.onLeak) > 0 {
+		leaks := newGoroutines(stacks)
+		for _, hook := range opts.onLeak {
+			hook(leaks)
+		}
+	}
+
+	var status string
+	switch {
+	case settled:
+		status = fmt.Sprintf("settled after %d identical samples", unchanged)
+	case unchanged > 1:
+		status = fmt.Sprintf("unchanged for the last %d of %d samples", unchanged, attempts)
+	default:
+		status = fmt.Sprintf("still changing after %d samples", attempts)
+	}
+	return &leakError{
+		stacks:       stacks,
+		status:       status,
+		exceeded:     exceeded,
+		suppressed:   report.suppressed,
+		background:   report.background,
+		dependencies: report.dependencies,
+	}
+}
+
+// leakError is returned by find if there are unexpected goroutines.
+type leakError struct {
+	stacks       []stack.Stack
+	status       string        // how the retries ended
+	exceeded     []string      // budgets that were exceeded
+	suppressed   []suppression // only with Explain
+	background   []suppression // only with Explain
+	dependencies int           // goroutines left out by OnlyInvolving
+}
+
+func (e *leakError) Error() string {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "found unexpected goroutines (%s):\n", e.status)
+	for _, b := range e.exceeded {
+		fmt.Fprintf(&msg, "%s\n", b)
+	}
+	var unparsed int
+	for _, s := range e.stacks {
+		if s.ParseError() != nil {
+			unparsed++
+		}
+	}
+	if unparsed > 0 {
+		// These can't be matched by any ignore options,
+		// so make it clear why they're reported.
+		fmt.Fprintf(&msg, "failed to parse %d goroutine stack traces; "+
+			"they're reported because they can't be checked against ignore options\n", unparsed)
+	}
+
+	e.writeStacks(&msg)
+	if (e.dependencies > 0 || len(e.suppressed) > 0 || len(e.background) > 0) &&
+		!strings.HasSuffix(msg.String(), "\n") {
+		msg.WriteByte('\n')
+	}
+
+	if e.dependencies > 0 {
+		fmt.Fprintf(&msg, "%d goroutines from dependencies suppressed\n", e.dependencies)
+	}
+	writeSuppressions(&msg, "ignored goroutines", e.suppressed)
+	writeSuppressions(&msg, "background goroutines", e.background)
+	return msg.String()
+}
+
+// writeSuppressions writes a list of goroutines that weren't reported,
+// with the reason for each, under the given heading.
+func writeSuppressions(msg *strings.Builder, heading string, suppressed []suppression) {
+	if len(suppressed) == 0 {
+		return
+	}
+	fmt.Fprintf(msg, "%s:\n", heading)
+	for _, s := range suppressed {
+		fmt.Fprintf(msg, "  %v\n", s)
+	}
+}
+
+// writeStacks writes the unexpected goroutines to msg,
+// grouped by the test that started them if known.
+func (e *leakError) writeStacks(msg *strings.Builder) {
+	byTest := make(map[string][]stack.Stack)
+	for _, s := range e.stacks {
+		test := s.Labels()[_testLabel]
+		byTest[test] = append(byTest[test], s)
+	}
+	if _, ok := byTest[""]; ok && len(byTest) == 1 {
+		// None of the goroutines are attributed to a test.
+		fmt.Fprintf(msg, "%s", e.stacks)
+		return
+	}
+
+	tests := make([]string, 0, len(byTest))
+	for test := range byTest {
+		if test != "" {
+			tests = append(tests, test)
+		}
+	}
+	sort.Strings(tests)
+	for _, test := range tests {
+		fmt.Fprintf(msg, "started by %s:\n%s\n", test, byTest[test])
+	}
+	if stacks, ok := byTest[""]; ok {
+		fmt.Fprintf(msg, "not attributed to a test:\n%s\n", stacks)
+	}
+}
+
+// sameStacks reports whether the two sets of goroutines are identical:
+// they have the same IDs, and each goroutine has the same state and stack.
+func sameStacks(a, b []stack.Stack) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	byID := make(map[int]stack.Stack, len(a))
+	for _, s := range a {
+		byID[s.ID()] = s
+	}
+	for _, s := range b {
+		other, ok := byID[s.ID()]
+		if !ok || other.State() != s.State() || other.Full() != s.Full() {
+			return false
+		}
+	}
+	return true
 }
 
 type testHelper interface {
 	Helper()
 }
 
+type testLogger interface {
+	Log(...interface{})
+}
+
 // VerifyNone marks the given TestingT as failed if any extra goroutines are
 // found by Find. This is a helper method to make it easier to integrate in
 // tests by doing:
@@ -100,8 +326,20 @@ func VerifyNone(t TestingT, options ...Option) {
 		// Mark this function as a test helper, if available.
 		h.Helper()
 	}
+	l, ok := t.(testLogger)
+	var warnings []string
+	if ok {
+		// Report warnings through the test, if possible. They're logged
+		// from here, after Find returns, so that they're attributed to
+		// the caller of VerifyNone.
+		opts.log = func(msg string) { warnings = append(warnings, msg) }
+	}
 
-	if err := Find(opts); err != nil {
+	err := Find(opts)
+	for _, msg := range warnings {
+		l.Log(msg)
+	}
+	if err != nil {
 		t.Error(err)
 	}
 
@@ -22,12 +22,14 @@ package goleak
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/internal/stack"
 )
 
 // Ensure that testingT is a subset of testing.TB.
@@ -74,14 +76,136 @@ func TestFindRetry(t *testing.T) {
 	require.NoError(t, Find(), "Find should retry while background goroutine ends")
 }
 
+func TestFindSettle(t *testing.T) {
+	t.Run("fails once settled", func(t *testing.T) {
+		bg := startBlockedG()
+		defer bg.unblock()
+
+		start := time.Now()
+		err := Find(SettleAfter(3))
+		require.Error(t, err, "Should find leaks with leaked goroutine")
+		assert.ErrorContains(t, err, "settled after 3 identical samples")
+		assert.ErrorContains(t, err, "blockedG")
+
+		// With the default backoff, giving up takes over a second.
+		assert.Less(t, time.Since(start), 500*time.Millisecond,
+			"Find should not wait for retries once settled")
+	})
+
+	t.Run("reports unchanged without settle", func(t *testing.T) {
+		bg := startBlockedG()
+		defer bg.unblock()
+
+		err := Find(testOptions())
+		require.Error(t, err, "Should find leaks with leaked goroutine")
+		assert.ErrorContains(t, err, "unchanged for the last")
+	})
+}
+
+func TestSameStacks(t *testing.T) {
+	// Wait for goroutines from other tests to exit.
+	require.NoError(t, Find())
+
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	cur := stack.Current().ID()
+	opts := buildOpts()
+	before := filterStacks(stack.All(), cur, opts)
+	require.Len(t, before, 1)
+
+	assert.True(t, sameStacks(before, filterStacks(stack.All(), cur, opts)),
+		"Blocked goroutine should not change between samples")
+	assert.False(t, sameStacks(before, nil), "Different number of goroutines")
+
+	bg2 := startBlockedG()
+	defer bg2.unblock()
+	after := filterStacks(stack.All(), cur, opts)
+	require.Len(t, after, 2)
+	assert.False(t, sameStacks(before, after), "New goroutine should change the set")
+}
+
+func TestLeakErrorParseError(t *testing.T) {
+	stacks, err := stack.Parse(strings.NewReader(strings.Join([]string{
+		"goroutine 1 [chan receive]:",
+		"example.com/foo.bar()",
+		"	/path/to/foo.go:10 +0x20",
+		"",
+		"goroutine 2 [chan receive]:",
+		"example.com/foo.bar",
+		"	/path/to/foo.go:10 +0x20",
+		"",
+	}, "\n")))
+	require.NoError(t, err)
+	require.Len(t, stacks, 2)
+
+	goroutines := newGoroutines(stacks)
+	assert.NoError(t, goroutines[0].ParseError())
+	assert.Error(t, goroutines[1].ParseError())
+
+	msg := (&leakError{stacks: stacks, status: "test"}).Error()
+	assert.Contains(t, msg, "failed to parse 1 goroutine stack traces")
+	assert.Contains(t, msg, "Goroutine 2 in state chan receive, failed to parse")
+	assert.Contains(t, msg, "example.com/foo.bar\n")
+}
+
+func TestFindHooks(t *testing.T) {
+	var calls []string
+	hooks := []Option{
+		BeforeCheck(func() { calls = append(calls, "before") }),
+		OnLeak(func(leaks []Goroutine) {
+			calls = append(calls, fmt.Sprintf("leak %v", len(leaks)))
+		}),
+		AfterCheck(func(err error) {
+			calls = append(calls, fmt.Sprintf("after %v", err != nil))
+		}),
+	}
+
+	t.Run("no leaks", func(t *testing.T) {
+		calls = nil
+		require.NoError(t, Find(hooks...))
+		assert.Equal(t, []string{"before", "after false"}, calls)
+	})
+
+	t.Run("leaks", func(t *testing.T) {
+		calls = nil
+		bg := startBlockedG()
+		defer bg.unblock()
+
+		require.Error(t, Find(append(hooks, testOptions())...))
+		assert.Equal(t, []string{"before", "leak 1", "after true"}, calls)
+	})
+
+	t.Run("BeforeCheck can stop leaks", func(t *testing.T) {
+		bg := startBlockedG()
+		require.NoError(t, Find(BeforeCheck(bg.unblock)))
+	})
+
+	t.Run("VerifyNone", func(t *testing.T) {
+		calls = nil
+		bg := startBlockedG()
+		defer bg.unblock()
+
+		ft := &fakeT{}
+		VerifyNone(ft, append(hooks, testOptions())...)
+		assert.NotEmpty(t, ft.errors)
+		assert.Equal(t, []string{"before", "leak 1", "after true"}, calls)
+	})
+}
+
 type fakeT struct {
 	errors []string
+	logs   []string
 }
 
 func (ft *fakeT) Error(args ...interface{}) {
 	ft.errors = append(ft.errors, fmt.Sprint(args...))
 }
 
+func (ft *fakeT) Log(args ...interface{}) {
+	ft.logs = append(ft.logs, fmt.Sprint(args...))
+}
+
 func TestVerifyNone(t *testing.T) {
 	t.Run("VerifyNone finds leaks", func(t *testing.T) {
 		ft := &fakeT{}
@@ -105,6 +229,55 @@ func TestVerifyNone(t *testing.T) {
 	})
 }
 
+func TestWarnOnly(t *testing.T) {
+	t.Run("option", func(t *testing.T) {
+		bg := startBlockedG()
+		defer bg.unblock()
+
+		ft := &fakeT{}
+		VerifyNone(ft, testOptions(), WarnOnly())
+		assert.Empty(t, ft.errors, "Leaks should not fail the test in warn-only mode")
+		require.Len(t, ft.logs, 1)
+		assert.Contains(t, ft.logs[0], "goleak: found 1 unexpected goroutines")
+		assert.Contains(t, ft.logs[0], "blockedG")
+	})
+
+	t.Run("env enables", func(t *testing.T) {
+		t.Setenv("GOLEAK_WARN_ONLY", "true")
+		bg := startBlockedG()
+		defer bg.unblock()
+
+		ft := &fakeT{}
+		VerifyNone(ft, testOptions())
+		assert.Empty(t, ft.errors, "Leaks should not fail the test in warn-only mode")
+		assert.Len(t, ft.logs, 1)
+	})
+
+	t.Run("env disables", func(t *testing.T) {
+		t.Setenv("GOLEAK_WARN_ONLY", "0")
+		bg := startBlockedG()
+		defer bg.unblock()
+
+		ft := &fakeT{}
+		VerifyNone(ft, testOptions(), WarnOnly())
+		assert.Len(t, ft.errors, 1)
+		assert.Empty(t, ft.logs)
+	})
+
+	t.Run("AfterCheck sees leaks", func(t *testing.T) {
+		bg := startBlockedG()
+		defer bg.unblock()
+
+		var checkErr error
+		ft := &fakeT{}
+		VerifyNone(ft, testOptions(), WarnOnly(), AfterCheck(func(err error) {
+			checkErr = err
+		}))
+		assert.Empty(t, ft.errors)
+		assert.Error(t, checkErr)
+	})
+}
+
 func TestIgnoreCurrent(t *testing.T) {
 	t.Run("Should ignore current", func(t *testing.T) {
 		defer VerifyNone(t)
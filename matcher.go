@@ -0,0 +1,181 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/goleak/internal/stack"
+)
+
+// Matcher reports whether a goroutine matches some criteria.
+// Matchers can be combined with [And], [Or], and [Not],
+// and used to ignore goroutines with [Ignore].
+type Matcher func(g Goroutine) bool
+
+// And matches goroutines that match all of the given matchers.
+// It matches all goroutines if there are none.
+func And(ms ...Matcher) Matcher {
+	return func(g Goroutine) bool {
+		for _, m := range ms {
+			if !m(g) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or matches goroutines that match any of the given matchers.
+// It matches no goroutines if there are none.
+func Or(ms ...Matcher) Matcher {
+	return func(g Goroutine) bool {
+		for _, m := range ms {
+			if m(g) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not matches goroutines that don't match the given matcher.
+func Not(m Matcher) Matcher {
+	return func(g Goroutine) bool {
+		return !m(g)
+	}
+}
+
+// TopFunction matches goroutines where the specified function
+// is at the top of the stack. The function name should be fully qualified,
+// e.g., go.uber.org/goleak.TopFunction.
+// See [IgnoreTopFunction] for how closures and wrappers are matched.
+func TopFunction(f string) Matcher {
+	m := newFuncMatcher(f)
+	return func(g Goroutine) bool {
+		return m.match(g.TopFunction())
+	}
+}
+
+// AnyFunction matches goroutines where the specified function
+// is present anywhere in the stack.
+// The function name should be fully qualified,
+// e.g., go.uber.org/goleak.AnyFunction.
+func AnyFunction(f string) Matcher {
+	m := newFuncMatcher(f)
+	return func(g Goroutine) bool {
+		return m.in(g.s)
+	}
+}
+
+// CreatedBy matches goroutines that were spawned from the specified
+// function. The function name should be fully qualified,
+// e.g., go.uber.org/goleak.CreatedBy.
+func CreatedBy(f string) Matcher {
+	m := newFuncMatcher(f)
+	return func(g Goroutine) bool {
+		return m.match(g.CreatedBy())
+	}
+}
+
+// Package matches goroutines that have a function from the given package
+// anywhere in the stack. The package is identified by its import path,
+// e.g. "net/http".
+func Package(pkg string) Matcher {
+	return func(g Goroutine) bool {
+		return g.s.HasPackage(pkg)
+	}
+}
+
+// State matches goroutines in the given state, e.g. "chan receive".
+// Details that the runtime appends to the state,
+// such as how long the goroutine has been blocked
+// or whether it's locked to a thread, are not compared,
+// so "chan receive" matches "chan receive, 5 minutes".
+func State(state string) Matcher {
+	return func(g Goroutine) bool {
+		s, _, _ := strings.Cut(g.State(), ", ")
+		return s == state
+	}
+}
+
+// BlockedFor matches goroutines that have been blocked
+// for at least the given duration.
+// The runtime only reports this in whole minutes
+// for goroutines that have been blocked for at least a minute,
+// so goroutines that have been blocked for less than a minute
+// only match durations of zero or less.
+func BlockedFor(d time.Duration) Matcher {
+	return func(g Goroutine) bool {
+		return g.WaitDuration() >= d
+	}
+}
+
+// FrameAt matches goroutines with a frame anywhere in the stack
+// at the given location, e.g. "foo/bar.go:42".
+// The location is matched against the end of the frame's file path,
+// as with [IgnoreCreatedAt].
+// A location without a line number matches nothing.
+func FrameAt(loc string) Matcher {
+	file, lineStr, _ := cutLast(loc, ":")
+	line, err := strconv.Atoi(lineStr)
+	return func(g Goroutine) bool {
+		if err != nil {
+			return false
+		}
+		return g.s.HasPosition(func(f string, l int) bool {
+			return l == line && hasPathSuffix(f, file)
+		})
+	}
+}
+
+// funcMatcher matches function names from stack traces
+// with a fully qualified function name given by the user.
+//
+// Names match exactly.
+// If the given name is a declared name, e.g., "example.com/foo.F",
+// it also matches the names that the compiler synthesizes
+// for closures and wrappers in that function, e.g., "example.com/foo.F.func1".
+// A synthesized name, e.g., "example.com/foo.F.func1",
+// only matches exactly, so it doesn't match other closures in F.
+type funcMatcher struct {
+	name     string
+	declared bool // name is unchanged by stack.CanonicalFunction
+}
+
+func newFuncMatcher(name string) funcMatcher {
+	return funcMatcher{
+		name:     name,
+		declared: stack.CanonicalFunction(name) == name,
+	}
+}
+
+// match reports whether the given function name matches.
+func (m funcMatcher) match(fn string) bool {
+	return fn == m.name || (m.declared && stack.CanonicalFunction(fn) == m.name)
+}
+
+// in reports whether any function in the given stack matches.
+func (m funcMatcher) in(s stack.Stack) bool {
+	return s.HasFunction(m.name) || (m.declared && s.HasCanonicalFunction(m.name))
+}
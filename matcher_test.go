@@ -0,0 +1,135 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak/internal/stack"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchers(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	var leaks []Goroutine
+	require.Error(t, Find(testOptions(), OnLeak(func(gs []Goroutine) {
+		leaks = gs
+	})))
+	require.Len(t, leaks, 1)
+	g := leaks[0]
+
+	tests := []struct {
+		name  string
+		match Matcher
+		want  bool
+	}{
+		{"TopFunction", TopFunction("go.uber.org/goleak.(*blockedG).block"), true},
+		{"TopFunction/not top", TopFunction("go.uber.org/goleak.(*blockedG).run"), false},
+		{"AnyFunction", AnyFunction("go.uber.org/goleak.(*blockedG).run"), true},
+		{"AnyFunction/creator", AnyFunction("go.uber.org/goleak.startBlockedG"), false},
+		{"CreatedBy", CreatedBy("go.uber.org/goleak.startBlockedG"), true},
+		{"CreatedBy/other", CreatedBy("go.uber.org/goleak.(*blockedG).run"), false},
+		// Synthesized names only match exactly.
+		{"TopFunction/closure", TopFunction("go.uber.org/goleak.(*blockedG).block.func1"), false},
+		{"AnyFunction/method value", AnyFunction("go.uber.org/goleak.(*blockedG).run-fm"), false},
+		{"CreatedBy/go wrapper", CreatedBy("go.uber.org/goleak.startBlockedG.gowrap1"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.match(g))
+		})
+	}
+}
+
+func TestPackageMatcher(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	var leaks []Goroutine
+	require.Error(t, Find(testOptions(), OnLeak(func(gs []Goroutine) {
+		leaks = gs
+	})))
+	require.Len(t, leaks, 1)
+
+	assert.True(t, Package("go.uber.org/goleak")(leaks[0]))
+	assert.False(t, Package("go.uber.org/goleak/internal/stack")(leaks[0]))
+	assert.False(t, Package("go.uber.org")(leaks[0]))
+}
+
+func TestMatcherCombinators(t *testing.T) {
+	stacks, err := stack.Parse(strings.NewReader(strings.Join([]string{
+		"goroutine 2 [chan receive, 5 minutes]:",
+		"example.com/foo/bar.baz()",
+		"	/path/to/example.com/foo/bar.go:123 +0x1d",
+		"example.com/foo/bar.qux()",
+		"	/path/to/example.com/foo/qux.go:45 +0x2e",
+		"created by example.com/foo/bar.start in goroutine 1",
+		"	/path/to/example.com/foo/start.go:67 +0x3f",
+		"",
+	}, "\n")))
+	require.NoError(t, err)
+	require.Len(t, stacks, 1)
+	g := Goroutine{s: stacks[0]}
+
+	var (
+		yes = TopFunction("example.com/foo/bar.baz")
+		no  = TopFunction("example.com/foo/bar.qux")
+	)
+	tests := []struct {
+		name  string
+		match Matcher
+		want  bool
+	}{
+		{"And", And(yes, AnyFunction("example.com/foo/bar.qux")), true},
+		{"And/one fails", And(yes, no), false},
+		{"And/empty", And(), true},
+		{"Or", Or(no, yes), true},
+		{"Or/none match", Or(no, no), false},
+		{"Or/empty", Or(), false},
+		{"Not", Not(no), true},
+		{"Not/match", Not(yes), false},
+		{"nested", And(yes, Not(Or(no, CreatedBy("example.com/foo/bar.other")))), true},
+		{"State", State("chan receive"), true},
+		{"State/full", State("chan receive, 5 minutes"), false},
+		{"State/other", State("select"), false},
+		{"BlockedFor", BlockedFor(5 * time.Minute), true},
+		{"BlockedFor/shorter", BlockedFor(time.Second), true},
+		{"BlockedFor/longer", BlockedFor(6 * time.Minute), false},
+		{"FrameAt", FrameAt("foo/qux.go:45"), true},
+		{"FrameAt/top", FrameAt("bar.go:123"), true},
+		{"FrameAt/other line", FrameAt("bar.go:45"), false},
+		{"FrameAt/creator", FrameAt("start.go:67"), false},
+		{"FrameAt/no line", FrameAt("bar.go"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.match(g))
+		})
+	}
+}
@@ -21,6 +21,10 @@
 package goleak
 
 import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -37,22 +41,72 @@ type Option interface {
 // a short while to let any running goroutines complete.
 const _defaultRetries = 20
 
+// _defaultMaxSleep is the longest we sleep between attempts.
+const _defaultMaxSleep = 100 * time.Millisecond
+
 type opts struct {
 	filters      []func(stack.Stack) bool
+	suppressors  []suppressor
+	ancestors    []Matcher // see IgnoreDescendantsOf
+	involving    []string  // see OnlyInvolving
+	companions   []companionFilter
 	maxRetries   int
 	maxSleep     time.Duration
+	timeout      time.Duration
+	budgets      []budget
+	settleAfter  int
+	slowExit     time.Duration
 	cleanup      func(int)
 	runOnFailure bool
+	warnOnly     bool
+	explain      bool
+	beforeCheck  []func()
+	onLeak       []func([]Goroutine)
+	afterCheck   []func(error)
+
+	// unknownPresets are the names passed to IgnorePreset
+	// that aren't presets. Find fails if there are any.
+	unknownPresets []string
+
+	// configErr is the error loading the config file for ConfigFile, if any.
+	// Find fails if it's set.
+	configErr error
+
+	// disabled and envErr are set from environment variables (see applyEnv).
+	disabled bool
+	envErr   error
+
+	// log reports warnings that should not fail the check.
+	// If unset, warnings are written to stderr.
+	log func(string)
 }
 
 // implement apply so that opts struct itself can be used as
 // an Option.
 func (o *opts) apply(opts *opts) {
 	opts.filters = o.filters
+	opts.suppressors = o.suppressors
+	opts.ancestors = o.ancestors
+	opts.involving = o.involving
+	opts.companions = o.companions
 	opts.maxRetries = o.maxRetries
 	opts.maxSleep = o.maxSleep
+	opts.timeout = o.timeout
+	opts.budgets = o.budgets
+	opts.settleAfter = o.settleAfter
+	opts.slowExit = o.slowExit
 	opts.cleanup = o.cleanup
 	opts.runOnFailure = o.runOnFailure
+	opts.warnOnly = o.warnOnly
+	opts.explain = o.explain
+	opts.unknownPresets = o.unknownPresets
+	opts.configErr = o.configErr
+	opts.disabled = o.disabled
+	opts.envErr = o.envErr
+	opts.beforeCheck = o.beforeCheck
+	opts.onLeak = o.onLeak
+	opts.afterCheck = o.afterCheck
+	opts.log = o.log
 }
 
 // optionFunc lets us easily write options without a custom type.
@@ -63,9 +117,21 @@ func (f optionFunc) apply(opts *opts) { f(opts) }
 // IgnoreTopFunction ignores any goroutines where the specified function
 // is at the top of the stack. The function name should be fully qualified,
 // e.g., go.uber.org/goleak.IgnoreTopFunction
+//
+// Names that the compiler generates for closures and wrappers,
+// which have changed between Go versions,
+// match the function that they're declared in.
+// For example, "example.com/foo.F" matches
+// "example.com/foo.F.func1", "example.com/foo.F.gowrap1",
+// and "example.com/foo.F[...]".
+// Such generated names only match exactly:
+// "example.com/foo.F.func1" doesn't match "example.com/foo.F.func2".
+// The same goes for the other options and matchers
+// that take function names, and for [Goroutine.HasFunction].
 func IgnoreTopFunction(f string) Option {
+	m := newFuncMatcher(f)
 	return addFilter(func(s stack.Stack) bool {
-		return s.FirstFunction() == f
+		return m.match(s.FirstFunction())
 	})
 }
 
@@ -80,8 +146,9 @@ func IgnoreTopFunction(f string) Option {
 //
 //	go.uber.org/goleak.(*MyType).MyMethod
 func IgnoreAnyFunction(f string) Option {
+	m := newFuncMatcher(f)
 	return addFilter(func(s stack.Stack) bool {
-		return s.HasFunction(f)
+		return m.in(s)
 	})
 }
 
@@ -89,8 +156,133 @@ func IgnoreAnyFunction(f string) Option {
 // specified function. The function name should be fully qualified, e.g.
 // go.uber.org/goleak.IgnoreCreatedBy.
 func IgnoreCreatedBy(f string) Option {
+	m := newFuncMatcher(f)
+	return addFilter(func(s stack.Stack) bool {
+		return m.match(s.CreatedBy())
+	})
+}
+
+// IgnoreCreatedAt ignores goroutines that were started by the go statement
+// at the given location, in the form "path/to/file.go:123".
+// The path may be shortened to its last few elements,
+// so this matches goroutines started at line 42 of any client.go file
+// in a directory named foo:
+//
+//	goleak.IgnoreCreatedAt("foo/client.go:42")
+//
+// Line numbers change whenever the file is edited,
+// so prefer ignoring goroutines by function where possible,
+// and use this only for goroutines that can't be told apart otherwise,
+// e.g. one of several closures started by the same function.
+// A location without a line number matches nothing.
+func IgnoreCreatedAt(loc string) Option {
+	file, lineStr, _ := cutLast(loc, ":")
+	line, err := strconv.Atoi(lineStr)
+	return addFilter(func(s stack.Stack) bool {
+		if err != nil {
+			return false
+		}
+		createdFile, createdLine := s.CreatedAt()
+		return createdLine == line && hasPathSuffix(createdFile, file)
+	})
+}
+
+// IgnoreCreatedInFile ignores goroutines that were started by a go statement
+// in a file that matches the given pattern.
+// The pattern uses the syntax of [path.Match],
+// and is matched against as many of the last elements of the file's path
+// as it has, unless it's an absolute path.
+// For example, this ignores goroutines started in generated files
+// in any directory named foo:
+//
+//	goleak.IgnoreCreatedInFile("foo/*.pb.go")
+//
+// A malformed pattern matches nothing.
+func IgnoreCreatedInFile(pattern string) Option {
 	return addFilter(func(s stack.Stack) bool {
-		return s.CreatedBy() == f
+		file, _ := s.CreatedAt()
+		return file != "" && matchPathSuffix(pattern, file)
+	})
+}
+
+// hasPathSuffix reports whether the given file path
+// ends with the given path elements.
+func hasPathSuffix(file, suffix string) bool {
+	return file == suffix || strings.HasSuffix(file, "/"+suffix)
+}
+
+// matchPathSuffix reports whether the last elements of the given file path
+// match the pattern, as with path.Match.
+// The file path is cut to the same number of elements as the pattern,
+// unless the pattern is an absolute path.
+func matchPathSuffix(pattern, file string) bool {
+	if !path.IsAbs(pattern) {
+		idx := len(file)
+		for n := strings.Count(pattern, "/"); n >= 0 && idx >= 0; n-- {
+			idx = strings.LastIndexByte(file[:idx], '/')
+		}
+		file = file[idx+1:]
+	}
+	ok, _ := path.Match(pattern, file)
+	return ok
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if idx := strings.LastIndex(s, sep); idx >= 0 {
+		return s[:idx], s[idx+len(sep):], true
+	}
+	return s, "", false
+}
+
+// Ignore ignores goroutines that match the given Matcher.
+// Use this with the Matcher combinators for conditions
+// that can't be expressed with the other Ignore options.
+// For example, this ignores goroutines started by a package's
+// worker pool only while they're waiting for work:
+//
+//	goleak.Ignore(goleak.And(
+//		goleak.CreatedBy("example.com/foo.(*Pool).Start"),
+//		goleak.State("chan receive"),
+//	))
+func Ignore(m Matcher) Option {
+	return addFilter(func(s stack.Stack) bool {
+		return m(Goroutine{s: s})
+	})
+}
+
+// Options bundles the given options into a single Option,
+// which makes it easy to share a set of options between tests:
+//
+//	var leakOptions = goleak.Options(
+//		goleak.IgnoreTopFunction("example.com/foo.worker"),
+//		goleak.IgnoreCreatedInFile("*.pb.go"),
+//	)
+//
+// Options are applied in order.
+func Options(options ...Option) Option {
+	return optionFunc(func(opts *opts) {
+		for _, option := range options {
+			option.apply(opts)
+		}
+	})
+}
+
+// IgnoreDescendantsOf ignores goroutines that were started, directly or
+// transitively, by a goroutine that matches the given Matcher.
+// For example, this ignores all goroutines started by a server
+// and by the goroutines that it started:
+//
+//	goleak.IgnoreDescendantsOf(goleak.TopFunction("example.com/foo.(*Server).Serve"))
+//
+// Ancestors are matched as they are when the check runs
+// if they are still running.
+// Ancestors that have exited are only known if
+// GODEBUG=tracebackancestors=N is set, and are matched as they were
+// when they started the next goroutine.
+func IgnoreDescendantsOf(m Matcher) Option {
+	return optionFunc(func(opts *opts) {
+		opts.ancestors = append(opts.ancestors, m)
 	})
 }
 
@@ -106,26 +298,130 @@ func Cleanup(cleanupFunc func(exitCode int)) Option {
 	})
 }
 
+// BeforeCheck registers a function that runs right before the leak check.
+// Use it to release resources that would otherwise show up as leaks,
+// e.g. with http.DefaultTransport's CloseIdleConnections,
+// or to flush loggers.
+//
+// It runs in [Find], [VerifyNone] and [VerifyTestMain].
+// Hooks run in the order they were passed.
+func BeforeCheck(hook func()) Option {
+	return optionFunc(func(opts *opts) {
+		opts.beforeCheck = append(opts.beforeCheck, hook)
+	})
+}
+
+// OnLeak registers a function that receives the leaked goroutines
+// if the leak check fails.
+// Use it to capture additional diagnostics,
+// such as heap profiles or the state of a service.
+//
+// It runs in [Find], [VerifyNone] and [VerifyTestMain].
+// Hooks run in the order they were passed.
+func OnLeak(hook func(leaks []Goroutine)) Option {
+	return optionFunc(func(opts *opts) {
+		opts.onLeak = append(opts.onLeak, hook)
+	})
+}
+
+// AfterCheck registers a function that runs right after the leak check
+// with its result: nil if no leaks were found.
+// Unlike [Cleanup], it does not receive an exit code,
+// and it may also be passed to [Find].
+//
+// It runs in [Find], [VerifyNone] and [VerifyTestMain].
+// Hooks run in the order they were passed.
+func AfterCheck(hook func(err error)) Option {
+	return optionFunc(func(opts *opts) {
+		opts.afterCheck = append(opts.afterCheck, hook)
+	})
+}
+
 // IgnoreCurrent records all current goroutines when the option is created, and ignores
 // them in any future Find/Verify calls.
 func IgnoreCurrent() Option {
-	excludeIDSet := map[int]bool{}
-	for _, s := range stack.All() {
-		excludeIDSet[s.ID()] = true
-	}
+	return IgnoreSnapshot(Take())
+}
+
+// IgnoreSnapshot ignores all goroutines that were running
+// when the given snapshot was taken.
+func IgnoreSnapshot(snap Snapshot) Option {
 	return addFilter(func(s stack.Stack) bool {
-		return excludeIDSet[s.ID()]
+		return snap.Contains(s.ID())
 	})
 }
 
 // RunOnFailure makes goleak look for leaking goroutines upon test failures.
 // By default goleak only looks for leaking goroutines when tests succeed.
+// Setting the GOLEAK_RUN_ON_FAILURE environment variable to true
+// enables this for VerifyTestMain, and setting it to false disables it.
 func RunOnFailure() Option {
 	return optionFunc(func(opts *opts) {
 		opts.runOnFailure = true
 	})
 }
 
+// SettleAfter makes Find stop retrying and report a failure as soon as
+// the set of unexpected goroutines has stayed the same for the given number
+// of consecutive samples.
+// Two samples are the same if they contain the same goroutine IDs,
+// and each goroutine is in the same state with the same stack.
+//
+// This is useful to report leaks that will never go away quickly,
+// without waiting out the full retry backoff.
+// Note that samples are taken with an exponential backoff starting at
+// a microsecond, so small values may declare goroutines that are about
+// to exit as settled. Values below 1 disable settle detection.
+func SettleAfter(samples int) Option {
+	return optionFunc(func(opts *opts) {
+		opts.settleAfter = samples
+	})
+}
+
+// Timeout makes Find keep retrying until the given total duration
+// has been spent waiting between retries,
+// instead of giving up after a fixed number of retries.
+// The check takes a little longer than that,
+// since looking at the goroutines takes time too.
+// Durations of zero or less restore the default number of retries.
+// The GOLEAK_TIMEOUT environment variable, e.g. "10s",
+// sets the timeout for all checks.
+func Timeout(d time.Duration) Option {
+	return optionFunc(func(opts *opts) {
+		opts.timeout = d
+	})
+}
+
+// WarnSlowExits reports a warning for each goroutine that was unexpected
+// when Find first looked, and took at least the given duration to exit
+// while Find was retrying.
+// Such goroutines don't fail the check, but slow shutdowns
+// often turn into flaky leaks.
+//
+// [VerifyNone] reports warnings with the test's Log method if available.
+// Otherwise, warnings are written to stderr.
+func WarnSlowExits(threshold time.Duration) Option {
+	return optionFunc(func(opts *opts) {
+		opts.slowExit = threshold
+	})
+}
+
+// WarnOnly reports leaks as warnings instead of failures.
+// [VerifyNone] logs leaks with the test's Log method if available,
+// [VerifyTestMain] writes them to stderr without changing the exit code,
+// and [Find] writes them to stderr and returns nil.
+// Each report starts with the number of leaked goroutines.
+//
+// This is intended for gradual adoption:
+// measure leaks in a package before enforcing that there are none.
+// Setting the GOLEAK_WARN_ONLY environment variable to true
+// enables this for all checks, and setting it to false disables it.
+func WarnOnly() Option {
+	return optionFunc(func(opts *opts) {
+		opts.warnOnly = true
+	})
+}
+
 func maxSleep(d time.Duration) Option {
 	return optionFunc(func(opts *opts) {
 		opts.maxSleep = d
@@ -141,7 +437,7 @@ func addFilter(f func(stack.Stack) bool) Option {
 func buildOpts(options ...Option) *opts {
 	opts := &opts{
 		maxRetries: _defaultRetries,
-		maxSleep:   100 * time.Millisecond,
+		maxSleep:   _defaultMaxSleep,
 	}
 	opts.filters = append(opts.filters,
 		isTestStack,
@@ -149,12 +445,114 @@ func buildOpts(options ...Option) *opts {
 		isStdLibStack,
 		isTraceStack,
 	)
+	opts.suppressors = append(opts.suppressors, isAnnotated, isRegisteredBackground)
 	for _, option := range options {
 		option.apply(opts)
 	}
+	applyEnv(opts)
 	return opts
 }
 
+// isDescendant reports whether the given stack was started by
+// a goroutine that matches any of the IgnoreDescendantsOf matchers.
+// Running goroutines are looked up by ID in byID.
+func (o *opts) isDescendant(s stack.Stack, byID map[int]stack.Stack) bool {
+	if len(o.ancestors) == 0 {
+		return false
+	}
+
+	match := func(s stack.Stack) bool {
+		for _, m := range o.ancestors {
+			if m(Goroutine{s: s}) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, a := range s.Ancestors() {
+		if match(a) {
+			return true
+		}
+	}
+
+	// Guard against cycles in case goroutine IDs are reused.
+	seen := map[int]struct{}{s.ID(): {}}
+	for id := s.ParentID(); id != 0; {
+		if _, ok := seen[id]; ok {
+			break
+		}
+		seen[id] = struct{}{}
+
+		parent, ok := byID[id]
+		if !ok {
+			break
+		}
+		if match(parent) {
+			return true
+		}
+		id = parent.ParentID()
+	}
+	return false
+}
+
+// filterReport records the goroutines that a check didn't report
+// although they weren't ignored outright.
+type filterReport struct {
+	suppressed   []suppression // only with Explain
+	background   []suppression // only with Explain, see Go
+	dependencies int           // see OnlyInvolving
+}
+
+// keepFunc returns a function that reports whether a goroutine
+// should be checked for leaks: it's not the goroutine with the given ID,
+// and it's not ignored by o.
+// Goroutines that are suppressed, marked as background, or that don't
+// involve the packages given to OnlyInvolving are recorded in report,
+// if it's not nil.
+func (o *opts) keepFunc(skipID int, report *filterReport) func(stack.Stack) bool {
+	return func(s stack.Stack) bool {
+		// Always skip the running goroutine.
+		if s.ID() == skipID {
+			return false
+		}
+		// Run any default or user-specified filters.
+		if o.filter(s) {
+			return false
+		}
+		if name, ok := s.Labels()[_backgroundLabel]; ok {
+			if o.explain && report != nil {
+				report.background = append(report.background, newSuppression(s, name))
+			}
+			return false
+		}
+		for _, suppress := range o.suppressors {
+			if reason, ok := suppress(s); ok {
+				if o.explain && report != nil {
+					report.suppressed = append(report.suppressed, newSuppression(s, reason))
+				}
+				return false
+			}
+		}
+		if !o.involves(s) {
+			if report != nil {
+				report.dependencies++
+			}
+			return false
+		}
+		return true
+	}
+}
+
+// err returns an error if the options are invalid.
+func (o *opts) err() error {
+	errs := []error{o.configErr, o.envErr}
+	if len(o.unknownPresets) > 0 {
+		errs = append(errs, unknownPresetsError(o.unknownPresets))
+	}
+	return errors.Join(errs...)
+}
+
 func (o *opts) filter(s stack.Stack) bool {
 	for _, filter := range o.filters {
 		if filter(s) {
@@ -164,17 +562,57 @@ func (o *opts) filter(s stack.Stack) bool {
 	return false
 }
 
+func (o *opts) warn(msg string) {
+	if o.log != nil {
+		o.log(msg)
+		return
+	}
+	fmt.Fprintf(_osStderr, "%v\n", msg)
+}
+
+func (o *opts) warnSlowExits(exits []slowExit) {
+	if o.slowExit <= 0 {
+		return
+	}
+	for _, e := range exits {
+		if e.elapsed >= o.slowExit {
+			o.warn(fmt.Sprintf("goleak: goroutine took %v to exit: %v", e.elapsed, e.stack))
+		}
+	}
+}
+
 func (o *opts) retry(i int) bool {
-	if i >= o.maxRetries {
+	if o.timeout > 0 {
+		if o.totalBackoff(i) >= o.timeout {
+			return false
+		}
+	} else if i >= o.maxRetries {
 		return false
 	}
 
+	time.Sleep(o.backoff(i))
+	return true
+}
+
+// backoff returns how long to wait after the given attempt
+// before trying again.
+func (o *opts) backoff(i int) time.Duration {
 	d := time.Duration(int(time.Microsecond) << uint(i))
-	if d > o.maxSleep {
+	// The shift overflows for large attempts.
+	if d <= 0 || d > o.maxSleep {
 		d = o.maxSleep
 	}
-	time.Sleep(d)
-	return true
+	return d
+}
+
+// totalBackoff returns how long retry waits in total
+// before the given attempt.
+func (o *opts) totalBackoff(i int) time.Duration {
+	var total time.Duration
+	for j := 0; j < i; j++ {
+		total += o.backoff(j)
+	}
+	return total
 }
 
 // isTestStack is a default filter installed to automatically skip goroutines
@@ -190,7 +628,7 @@ func isTestStack(s stack.Stack) bool {
 	// function with all seed corpus have run.
 	// testing.runFuzzing is for fuzz testing, it's blocked until a failing
 	// input is found.
-	switch s.FirstFunction() {
+	switch stack.CanonicalFunction(s.FirstFunction()) {
 	case "testing.RunTests", "testing.(*T).Run", "testing.(*T).Parallel", "testing.runFuzzing", "testing.runFuzzTests":
 		// In pre1.7 and post-1.7, background goroutines started by the testing
 		// package are blocked waiting on a channel.
@@ -202,20 +640,20 @@ func isTestStack(s stack.Stack) bool {
 func isSyscallStack(s stack.Stack) bool {
 	// Typically runs in the background when code uses CGo:
 	// https://github.com/golang/go/issues/16714
-	return s.HasFunction("runtime.goexit") && strings.HasPrefix(s.State(), "syscall")
+	return s.HasCanonicalFunction("runtime.goexit") && strings.HasPrefix(s.State(), "syscall")
 }
 
 func isStdLibStack(s stack.Stack) bool {
 	// Importing os/signal starts a background goroutine.
 	// The name of the function at the top has changed between versions.
-	if f := s.FirstFunction(); f == "os/signal.signal_recv" || f == "os/signal.loop" {
+	if f := stack.CanonicalFunction(s.FirstFunction()); f == "os/signal.signal_recv" || f == "os/signal.loop" {
 		return true
 	}
 
 	// Using signal.Notify will start a runtime goroutine.
-	return s.HasFunction("runtime.ensureSigM")
+	return s.HasCanonicalFunction("runtime.ensureSigM")
 }
 
 func isTraceStack(s stack.Stack) bool {
-	return s.HasFunction("runtime.ReadTrace")
+	return s.HasCanonicalFunction("runtime.ReadTrace")
 }
@@ -21,6 +21,10 @@
 package goleak
 
 import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -73,10 +77,15 @@ func TestOptionsFilters(t *testing.T) {
 
 func TestOptionsIgnoreCreatedBy(t *testing.T) {
 	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
 	go func() {
+		defer close(doneCh)
 		<-stopCh
 	}()
-	defer close(stopCh)
+	defer func() {
+		close(stopCh)
+		<-doneCh
+	}()
 
 	cur := stack.Current()
 	opts := buildOpts(IgnoreCreatedBy("go.uber.org/goleak.TestOptionsIgnoreCreatedBy"))
@@ -94,6 +103,213 @@ func TestOptionsIgnoreCreatedBy(t *testing.T) {
 	}
 }
 
+// startTree starts a goroutine that starts another goroutine,
+// and blocks until stop is closed.
+// It returns after both goroutines have started.
+func startTree(stop <-chan struct{}, done *sync.WaitGroup) {
+	started := make(chan struct{})
+	done.Add(1)
+	go func() {
+		defer done.Done()
+		blockTree(stop, done, started)
+	}()
+	<-started
+}
+
+func blockTree(stop <-chan struct{}, done *sync.WaitGroup, started chan<- struct{}) {
+	done.Add(1)
+	go func() {
+		defer done.Done()
+		close(started)
+		<-stop
+	}()
+	<-stop
+}
+
+func TestOptionsIgnoreDescendantsOf(t *testing.T) {
+	if !hasParentIDs() {
+		t.Skip("IgnoreDescendantsOf requires Go 1.21 or newer")
+	}
+
+	stop := make(chan struct{})
+	var done sync.WaitGroup
+	defer func() {
+		close(stop)
+		done.Wait()
+	}()
+	startTree(stop, &done)
+
+	var leaks []Goroutine
+	err := Find(
+		testOptions(),
+		IgnoreDescendantsOf(TopFunction("go.uber.org/goleak.blockTree")),
+		OnLeak(func(gs []Goroutine) { leaks = gs }),
+	)
+	require.Error(t, err)
+	require.Len(t, leaks, 1, "only the parent should be reported")
+	assert.Equal(t, "go.uber.org/goleak.blockTree", leaks[0].TopFunction())
+
+	assert.NoError(t, Find(
+		testOptions(),
+		IgnoreTopFunction("go.uber.org/goleak.blockTree"),
+		IgnoreDescendantsOf(TopFunction("go.uber.org/goleak.blockTree")),
+	))
+}
+
+func TestOptionsCanonicalNames(t *testing.T) {
+	stop := make(chan struct{})
+	var done sync.WaitGroup
+	defer func() {
+		close(stop)
+		done.Wait()
+	}()
+
+	// The closure's name depends on the Go version,
+	// e.g. TestOptionsCanonicalNames.func2.
+	started := make(chan struct{})
+	var id int
+	done.Add(1)
+	go func() {
+		defer done.Done()
+		id = stack.Current().ID()
+		close(started)
+		<-stop
+	}()
+	<-started
+
+	var closure string
+	for _, s := range stack.All() {
+		if s.ID() == id {
+			closure = s.FirstFunction()
+		}
+	}
+	require.NotEmpty(t, closure)
+	otherClosure := closure[:strings.LastIndexByte(closure, '.')] + ".func999"
+
+	const testFunc = "go.uber.org/goleak.TestOptionsCanonicalNames"
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{"IgnoreTopFunction", IgnoreTopFunction(testFunc)},
+		{"IgnoreTopFunction/exact", IgnoreTopFunction(closure)},
+		{"IgnoreAnyFunction", IgnoreAnyFunction(testFunc)},
+		{"IgnoreAnyFunction/exact", IgnoreAnyFunction(closure)},
+		{"IgnoreCreatedBy", IgnoreCreatedBy(testFunc)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, Find(testOptions(), tt.opt))
+		})
+	}
+
+	assert.Error(t, Find(testOptions(), IgnoreTopFunction(testFunc+"Other")),
+		"different functions should not match")
+	assert.Error(t, Find(testOptions(), IgnoreTopFunction(otherClosure)),
+		"a closure should not match other closures in the same function")
+	assert.Error(t, Find(testOptions(), IgnoreAnyFunction(otherClosure)),
+		"a closure should not match other closures in the same function")
+	assert.Error(t, Find(testOptions(), IgnoreCreatedBy(testFunc+".func1")),
+		"a closure should not match the function it's declared in")
+}
+
+func TestOptionsIgnore(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	blocked := TopFunction("go.uber.org/goleak.(*blockedG).block")
+	tests := []struct {
+		name string
+		opt  Option
+		want bool // whether the goroutine is ignored
+	}{
+		{"matcher", Ignore(blocked), true},
+		{"combined", Ignore(And(blocked, State("chan receive"))), true},
+		{"combined/other state", Ignore(And(blocked, State("select"))), false},
+		{"bundle", Options(IgnoreTopFunction("example.com/foo.bar"), Ignore(blocked)), true},
+		{"bundle/nested", Options(Options(Ignore(blocked))), true},
+		{"bundle/no match", Options(Ignore(Not(blocked))), false},
+		{"bundle/empty", Options(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Find(testOptions(), tt.opt)
+			if tt.want {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestOptionsIgnoreCreatedAt(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	var leaks []Goroutine
+	require.Error(t, Find(testOptions(), OnLeak(func(gs []Goroutine) {
+		leaks = gs
+	})))
+	require.Len(t, leaks, 1)
+	file, line := leaks[0].CreatedAt()
+	require.Equal(t, "utils_test.go", filepath.Base(file))
+
+	dir := filepath.Base(filepath.Dir(file))
+	tests := []struct {
+		name string
+		opt  Option
+		want bool // whether the goroutine is ignored
+	}{
+		{"file", IgnoreCreatedAt(fmt.Sprintf("utils_test.go:%d", line)), true},
+		{"dir", IgnoreCreatedAt(fmt.Sprintf("%v/utils_test.go:%d", dir, line)), true},
+		{"full path", IgnoreCreatedAt(fmt.Sprintf("%v:%d", file, line)), true},
+		{"other line", IgnoreCreatedAt(fmt.Sprintf("utils_test.go:%d", line+1)), false},
+		{"partial name", IgnoreCreatedAt(fmt.Sprintf("ils_test.go:%d", line)), false},
+		{"no line", IgnoreCreatedAt("utils_test.go"), false},
+		{"in file", IgnoreCreatedInFile("utils_test.go"), true},
+		{"in file pattern", IgnoreCreatedInFile(dir + "/*_test.go"), true},
+		{"in file absolute", IgnoreCreatedInFile(filepath.Dir(file) + "/*.go"), true},
+		{"in other file", IgnoreCreatedInFile("options_test.go"), false},
+		{"in file bad pattern", IgnoreCreatedInFile("[utils_test.go"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Find(testOptions(), tt.opt)
+			if tt.want {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestMatchPathSuffix(t *testing.T) {
+	tests := []struct {
+		pattern string
+		file    string
+		want    bool
+	}{
+		{"foo.go", "/src/pkg/foo.go", true},
+		{"*.go", "/src/pkg/foo.go", true},
+		{"pkg/*.go", "/src/pkg/foo.go", true},
+		{"src/*/foo.go", "/src/pkg/foo.go", true},
+		{"/src/*/foo.go", "/src/pkg/foo.go", true},
+		{"/pkg/*.go", "/src/pkg/foo.go", false},
+		{"other/*.go", "/src/pkg/foo.go", false},
+		{"a/b/c/d/*.go", "/src/pkg/foo.go", false},
+		{"example.com/pkg/foo.go", "example.com/pkg/foo.go", true},
+		{"*", "foo.go", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.file, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchPathSuffix(tt.pattern, tt.file))
+		})
+	}
+}
+
 func TestOptionsIgnoreAnyFunction(t *testing.T) {
 	cur := stack.Current()
 	opts := buildOpts(IgnoreAnyFunction("go.uber.org/goleak.(*blockedG).run"))
@@ -122,3 +338,25 @@ func TestOptionsRetry(t *testing.T) {
 	assert.False(t, opts.retry(51), "Attempt 51/51 should not allow retrying")
 	assert.False(t, opts.retry(52), "Attempt 52/51 should not allow retrying")
 }
+
+func TestOptionsTimeout(t *testing.T) {
+	opts := buildOpts(maxSleep(time.Millisecond), Timeout(10*time.Millisecond))
+
+	// 1+2+4+...+512µs is about 1ms, then 1ms per attempt.
+	assert.True(t, opts.retry(0))
+	assert.True(t, opts.retry(18), "total backoff is under the timeout")
+	assert.False(t, opts.retry(19), "total backoff reached the timeout")
+	assert.False(t, opts.retry(25))
+
+	opts = buildOpts(Timeout(time.Second), Timeout(0))
+	assert.False(t, opts.retry(_defaultRetries), "should use the default number of retries")
+}
+
+func TestOptionsBackoff(t *testing.T) {
+	opts := buildOpts(maxSleep(time.Second))
+
+	assert.Equal(t, time.Microsecond, opts.backoff(0))
+	assert.Equal(t, 8*time.Microsecond, opts.backoff(3))
+	assert.Equal(t, time.Second, opts.backoff(30), "should be capped by max sleep")
+	assert.Equal(t, time.Second, opts.backoff(100), "should not overflow")
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.uber.org/goleak/internal/stack"
+)
+
+// _presets are the named sets of goroutines that IgnorePreset ignores,
+// keyed by the import path of the library that starts them.
+//
+// Each preset must have a fixture in testdata/presets
+// with stack traces of the goroutines that it ignores.
+// See testdata/presets/Makefile.
+var _presets = map[string]preset{
+	// The worker that aggregates views, started when the package is imported.
+	"go.opencensus.io": {
+		ignore: AnyFunction("go.opencensus.io/stats/view.(*worker).start"),
+	},
+
+	// The daemon that periodically flushes logs, started when the package is imported.
+	// The receiver changed in v1.1.0.
+	"github.com/golang/glog": {
+		ignore: Or(
+			AnyFunction("github.com/golang/glog.(*loggingT).flushDaemon"),
+			AnyFunction("github.com/golang/glog.(*fileSink).flushDaemon"),
+		),
+	},
+
+	// The balancer and resolver of a ClientConn.
+	// Its transports are not ignored, so connections that
+	// were never closed are still reported.
+	"google.golang.org/grpc": {
+		ignore: Or(
+			// Before v1.56.
+			AnyFunction("google.golang.org/grpc.(*ccBalancerWrapper).watcher"),
+			AnyFunction("google.golang.org/grpc/internal/resolver/dns.(*dnsResolver).watcher"),
+			// Since v1.56, the balancer and resolver wrappers
+			// run callbacks on serializers.
+			AnyFunction("google.golang.org/grpc/internal/grpcsync.(*CallbackSerializer).run"),
+		),
+	},
+
+	// The read and write loops of idle keep-alive connections
+	// in an http.Transport's pool.
+	//
+	// The read loop of an HTTP/1 connection waits for the next response
+	// in bufio.(*Reader).Peek, both while the connection is idle
+	// and while a request is in flight, in which case the goroutine
+	// waiting for the response is reported.
+	// While a response body is open, it waits for the body to be closed,
+	// so connections with bodies that were never closed are still reported.
+	// The write loop looks the same either way,
+	// so it's ignored only along with the read loop of its connection.
+	//
+	// HTTP/2 connections have a single read loop for all streams,
+	// which waits for frames whether or not any streams are open.
+	"net/http": {
+		ignore: Or(
+			_idleHTTPReadLoop,
+			CreatedBy("net/http.(*http2Transport).newClientConn"),
+		),
+		companions: []companionFilter{{
+			lead:      _idleHTTPReadLoop,
+			companion: TopFunction("net/http.(*persistConn).writeLoop"),
+			key:       persistConn,
+		}},
+	},
+
+	// The goroutines that open and clean up connections for a DB.
+	// They're matched by creator so that they're ignored
+	// even before they start running.
+	"database/sql": {
+		ignore: Or(
+			CreatedBy("database/sql.OpenDB"),
+			CreatedBy("database/sql.(*DB).startCleanerLocked"),
+		),
+	},
+}
+
+// preset is a set of goroutines that IgnorePreset ignores.
+type preset struct {
+	ignore     Matcher
+	companions []companionFilter
+}
+
+// _idleHTTPReadLoop matches the read loop of an HTTP/1 connection
+// that's waiting for the next response.
+var _idleHTTPReadLoop = And(
+	AnyFunction("net/http.(*persistConn).readLoop"),
+	AnyFunction("bufio.(*Reader).Peek"),
+)
+
+// persistConn returns the address of the net/http.persistConn
+// that the goroutine is the read or write loop of.
+func persistConn(g Goroutine) string {
+	return receiver(g,
+		"net/http.(*persistConn).readLoop",
+		"net/http.(*persistConn).writeLoop",
+	)
+}
+
+// receiver returns the first argument, i.e., the receiver of a method,
+// of the first call in the goroutine's stack to one of the given functions,
+// or "" if none of them are called.
+func receiver(g Goroutine, funcs ...string) string {
+	for _, line := range strings.Split(g.Stack(), "\n") {
+		for _, fn := range funcs {
+			args, ok := strings.CutPrefix(line, fn+"(")
+			if !ok {
+				continue
+			}
+			if end := strings.IndexAny(args, ",)"); end > 0 {
+				// Values that may be inaccurate are followed by "?".
+				return strings.TrimSuffix(args[:end], "?")
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// companionFilter ignores goroutines that run alongside
+// another goroutine that's ignored, e.g., the write loop of an idle
+// connection, whose own stack doesn't tell whether the connection is idle.
+type companionFilter struct {
+	// lead matches goroutines that are ignored on their own.
+	lead Matcher
+
+	// companion matches goroutines that are ignored
+	// if there's a lead goroutine with the same key.
+	companion Matcher
+
+	// key identifies the goroutines that run alongside each other,
+	// or returns "" if it can't.
+	key func(Goroutine) string
+}
+
+// ignoredCompanions returns the IDs of the goroutines in the given stacks
+// that are ignored by the companion filters.
+func (o *opts) ignoredCompanions(stacks []stack.Stack) map[int]struct{} {
+	if len(o.companions) == 0 {
+		return nil
+	}
+
+	ignored := make(map[int]struct{})
+	for _, c := range o.companions {
+		leads := make(map[string]struct{})
+		for _, s := range stacks {
+			if g := (Goroutine{s: s}); c.lead(g) {
+				if key := c.key(g); key != "" {
+					leads[key] = struct{}{}
+				}
+			}
+		}
+		for _, s := range stacks {
+			if g := (Goroutine{s: s}); c.companion(g) {
+				if _, ok := leads[c.key(g)]; ok {
+					ignored[s.ID()] = struct{}{}
+				}
+			}
+		}
+	}
+	return ignored
+}
+
+// IgnorePreset ignores the background goroutines of well-known libraries,
+// which are running for as long as the library is in use,
+// and often for the lifetime of the program.
+// Presets are named by the import path of the library, e.g.:
+//
+//	goleak.VerifyNone(t, goleak.IgnorePreset("net/http", "go.opencensus.io"))
+//
+// They're maintained with the function names of recent versions
+// of each library. See [Presets] for the available presets.
+// Find fails if any of the names isn't a known preset.
+func IgnorePreset(names ...string) Option {
+	var (
+		matchers   []Matcher
+		companions []companionFilter
+		unknown    []string
+	)
+	for _, name := range names {
+		if p, ok := _presets[name]; ok {
+			matchers = append(matchers, p.ignore)
+			companions = append(companions, p.companions...)
+		} else {
+			unknown = append(unknown, name)
+		}
+	}
+	return optionFunc(func(opts *opts) {
+		opts.unknownPresets = append(opts.unknownPresets, unknown...)
+		opts.companions = append(opts.companions, companions...)
+		if len(matchers) > 0 {
+			Ignore(Or(matchers...)).apply(opts)
+		}
+	})
+}
+
+// Presets returns the sorted names of the presets that IgnorePreset accepts.
+func Presets() []string {
+	names := make([]string, 0, len(_presets))
+	for name := range _presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// unknownPresetsError returns the error for the given names
+// that were passed to IgnorePreset, but aren't known presets.
+func unknownPresetsError(names []string) error {
+	return fmt.Errorf("unknown presets %q, must be one of: %v",
+		names, strings.Join(Presets(), ", "))
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/internal/stack"
+)
+
+func TestPresetFixtures(t *testing.T) {
+	tests := []struct {
+		preset      string
+		wantIgnored int
+		wantKept    int
+
+		// Each of these must match a goroutine that is kept.
+		wantKeep []Matcher
+	}{
+		{"database/sql", 2, 1, nil},
+		{"github.com/golang/glog", 1, 1, nil},
+		{"go.opencensus.io", 1, 1, nil},
+		{
+			// Transports are kept.
+			"google.golang.org/grpc", 3, 7,
+			[]Matcher{CreatedBy("google.golang.org/grpc/internal/transport.NewHTTP2Client")},
+		},
+		{
+			// Servers, and the connection with an unclosed body, are kept.
+			"net/http", 2, 6,
+			[]Matcher{
+				TopFunction("net/http.(*persistConn).readLoop"),
+				TopFunction("net/http.(*persistConn).writeLoop"),
+			},
+		},
+	}
+
+	var names []string
+	for _, tt := range tests {
+		names = append(names, tt.preset)
+	}
+	require.Equal(t, Presets(), names, "every preset must have a fixture")
+
+	for _, tt := range tests {
+		t.Run(tt.preset, func(t *testing.T) {
+			name := strings.ReplaceAll(tt.preset, "/", "_") + ".txt"
+			f, err := os.Open(filepath.Join("testdata", "presets", name))
+			require.NoError(t, err)
+			defer func() {
+				assert.NoError(t, f.Close())
+			}()
+
+			stacks, err := stack.Parse(f)
+			require.NoError(t, err)
+			for _, s := range stacks {
+				require.NoError(t, s.ParseError())
+			}
+
+			var opts opts
+			IgnorePreset(tt.preset).apply(&opts)
+			all := len(stacks)
+			kept := filterStacksWith(stacks, opts.keepFunc(0, nil), &opts)
+			assert.Equal(t, tt.wantIgnored, all-len(kept), "ignored goroutines")
+			assert.Equal(t, tt.wantKept, len(kept), "kept goroutines")
+
+			for i, m := range tt.wantKeep {
+				assert.True(t, anyMatches(newGoroutines(kept), m),
+					"wantKeep[%d] must match a kept goroutine", i)
+			}
+		})
+	}
+}
+
+func anyMatches(gs []Goroutine, m Matcher) bool {
+	for _, g := range gs {
+		if m(g) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestIgnorePresetHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.WriteString(w, "hello")
+		assert.NoError(t, err)
+	}))
+	defer srv.Close()
+
+	transport := &http.Transport{}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+
+	opts := Options(
+		testOptions(),
+		IgnorePreset("net/http"),
+		// The server's goroutines.
+		IgnoreAnyFunction("net/http.(*Server).Serve"),
+		IgnoreCreatedBy("net/http.(*Server).Serve"),
+	)
+
+	res, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, res.Body)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	assert.NoError(t, Find(opts), "idle connections should be ignored")
+
+	res, err = client.Get(srv.URL)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, res.Body.Close())
+	}()
+	err = Find(opts)
+	require.Error(t, err, "connections with unclosed bodies should be reported")
+	assert.Contains(t, err.Error(), "net/http.(*persistConn).readLoop")
+	assert.Contains(t, err.Error(), "net/http.(*persistConn).writeLoop")
+}
+
+func TestIgnorePresetNotStarted(t *testing.T) {
+	// Goroutines that were started, but haven't run yet,
+	// only have the wrapper of the go statement on their stack.
+	stacks, err := stack.Parse(strings.NewReader(strings.Join([]string{
+		"goroutine 6 [runnable]:",
+		"database/sql.OpenDB.gowrap1()",
+		"	/usr/local/go/src/database/sql/sql.go:846",
+		"runtime.goexit({})",
+		"	/usr/local/go/src/runtime/asm_amd64.s:1700 +0x1",
+		"created by database/sql.OpenDB in goroutine 1",
+		"	/usr/local/go/src/database/sql/sql.go:846 +0x135",
+		"",
+	}, "\n")))
+	require.NoError(t, err)
+	require.Len(t, stacks, 1)
+
+	var opts opts
+	IgnorePreset("database/sql").apply(&opts)
+	assert.True(t, opts.filter(stacks[0]))
+}
+
+func TestIgnorePresetUnknown(t *testing.T) {
+	err := Find(IgnorePreset("net/http", "example.com/foo", "bar"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown presets ["example.com/foo" "bar"]`)
+	assert.Contains(t, err.Error(), "net/http")
+
+	assert.NoError(t, Find(IgnorePreset("net/http")))
+}
+
+func TestPresets(t *testing.T) {
+	names := Presets()
+	assert.True(t, sort.StringsAreSorted(names))
+	assert.Contains(t, names, "net/http")
+
+	names[0] = "changed"
+	assert.NotEqual(t, "changed", Presets()[0], "must return a copy")
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"errors"
+
+	"go.uber.org/goleak/internal/stack"
+)
+
+// Leak is a goroutine that was still running after
+// the function passed to [Scope] returned.
+type Leak struct {
+	Goroutine
+
+	// Depth is how far removed the goroutine is from the function:
+	// 1 if the function started it, 2 if a goroutine started
+	// by the function started it, and so on.
+	Depth int
+}
+
+// Scope runs fn on the calling goroutine, and reports the goroutines
+// that fn started, directly or transitively, that are still running
+// after it returns. Other goroutines in the process are not reported.
+// Like [Find], it retries to give goroutines a chance to exit,
+// and ignores the same goroutines that Find would ignore
+// with the given options, e.g., those passed to [IgnoreTopFunction],
+// [AllowUpTo], [IgnoreDescendantsOf], or [OnlyInvolving],
+// and background goroutines.
+//
+// Unlike [VerifyNone], Scope doesn't need a TestingT and ignores
+// goroutines unrelated to fn, so it can be used outside of tests,
+// e.g. around request handlers or batch jobs in a debug mode:
+//
+//	leaks, err := goleak.Scope(func() { handle(req) })
+//
+// Scope relies on the parent goroutine IDs in stack traces,
+// which requires Go 1.21 or newer, and returns an error otherwise.
+// A goroutine is attributed to fn only if all goroutines between it and fn
+// are still running when Scope first looks after fn returns.
+func Scope(fn func(), options ...Option) ([]Leak, error) {
+	opts := buildOpts(options...)
+	if opts.cleanup != nil {
+		return nil, errors.New("Cleanup can only be passed to VerifyNone or VerifyTestMain")
+	}
+	if opts.runOnFailure {
+		return nil, errors.New("RunOnFailure can only be passed to VerifyTestMain")
+	}
+	if err := opts.err(); err != nil {
+		return nil, err
+	}
+
+	cur := stack.Current().ID()
+	before := Take()
+	fn()
+
+	// Goroutines known to be started by fn, directly or transitively,
+	// mapped to their depth.
+	spawned := map[int]int{cur: 0}
+
+	keep := opts.keepFunc(cur, nil)
+
+	var leaks []Leak
+	retry := true
+	for i := 0; retry; i++ {
+		all := allStacks()
+		if err := checkParentIDs(all); err != nil {
+			return nil, err
+		}
+
+		// Stacks are not ordered by parent,
+		// so keep going until no new descendants are found.
+		for found := true; found; {
+			found = false
+			for _, s := range all {
+				if _, ok := spawned[s.ID()]; ok || before.Contains(s.ID()) {
+					continue
+				}
+				if depth, ok := spawned[s.ParentID()]; ok {
+					spawned[s.ID()] = depth + 1
+					found = true
+				}
+			}
+		}
+
+		stacks := filterStacksWith(all, func(s stack.Stack) bool {
+			_, ok := spawned[s.ID()]
+			return ok && keep(s)
+		}, opts)
+		stacks, _ = applyBudgets(stacks, opts)
+
+		leaks = leaks[:0]
+		for _, s := range stacks {
+			leaks = append(leaks, Leak{Goroutine: Goroutine{s: s}, Depth: spawned[s.ID()]})
+		}
+		if len(leaks) == 0 {
+			return nil, nil
+		}
+		retry = opts.retry(i)
+	}
+	return leaks, nil
+}
+
+// checkParentIDs returns an error if the given stacks
+// don't include the IDs of their parent goroutines.
+// Goroutines started from system stacks never have a parent ID,
+// so this only fails if no goroutine has one.
+func checkParentIDs(stacks []stack.Stack) error {
+	var created bool
+	for _, s := range stacks {
+		if s.ParentID() != 0 {
+			return nil
+		}
+		created = created || s.CreatedBy() != ""
+	}
+	if created {
+		return errors.New("goleak: parent goroutine IDs are not available, " +
+			"Scope requires Go 1.21 or newer")
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/internal/stack"
+)
+
+// hasParentIDs reports whether stack traces include parent goroutine IDs.
+func hasParentIDs() bool {
+	return strings.Contains(stack.Current().Full(), " in goroutine ")
+}
+
+func TestScope(t *testing.T) {
+	if !hasParentIDs() {
+		t.Skip("Scope requires Go 1.21 or newer")
+	}
+
+	t.Run("no leaks", func(t *testing.T) {
+		leaks, err := Scope(func() {
+			startBlockedG().unblock()
+		})
+		require.NoError(t, err)
+		assert.Empty(t, leaks)
+	})
+
+	t.Run("ignores unrelated goroutines", func(t *testing.T) {
+		bg := startBlockedG()
+		defer bg.unblock()
+
+		leaks, err := Scope(func() {}, testOptions())
+		require.NoError(t, err)
+		assert.Empty(t, leaks)
+	})
+
+	t.Run("transitive leaks", func(t *testing.T) {
+		var (
+			direct, nested *blockedG
+			parentStop     = make(chan struct{})
+			parentDone     = make(chan struct{})
+		)
+		leaks, err := Scope(func() {
+			direct = startBlockedG()
+
+			started := make(chan struct{})
+			go func() {
+				defer close(parentDone)
+				nested = startBlockedG()
+				close(started)
+				<-parentStop
+			}()
+			<-started
+		}, testOptions())
+		defer func() {
+			direct.unblock()
+			nested.unblock()
+			close(parentStop)
+			<-parentDone
+		}()
+
+		require.NoError(t, err)
+		require.Len(t, leaks, 3)
+
+		depths := make(map[int]int)
+		for _, l := range leaks {
+			depths[l.ID()] = l.Depth
+		}
+		assert.Equal(t, 1, depths[direct.id])
+		assert.Equal(t, 2, depths[nested.id])
+	})
+
+	t.Run("honors filters", func(t *testing.T) {
+		var bg *blockedG
+		leaks, err := Scope(func() {
+			bg = startBlockedG()
+		}, IgnoreTopFunction("go.uber.org/goleak.(*blockedG).block"))
+		defer bg.unblock()
+
+		require.NoError(t, err)
+		assert.Empty(t, leaks)
+	})
+
+	t.Run("honors budgets", func(t *testing.T) {
+		allow := AllowUpTo(CreatedBy("go.uber.org/goleak.startBlockedG"), 1)
+
+		var bgs []*blockedG
+		defer func() {
+			for _, bg := range bgs {
+				bg.unblock()
+			}
+		}()
+
+		leaks, err := Scope(func() {
+			bgs = append(bgs, startBlockedG())
+		}, allow, testOptions())
+		require.NoError(t, err)
+		assert.Empty(t, leaks, "goroutines within budget should be ignored")
+
+		leaks, err = Scope(func() {
+			bgs = append(bgs, startBlockedG(), startBlockedG())
+		}, allow, testOptions())
+		require.NoError(t, err)
+		assert.Len(t, leaks, 2, "all goroutines should be reported over budget")
+	})
+
+	t.Run("ignores background goroutines", func(t *testing.T) {
+		defer _readLabels.Store(false)
+
+		stop, done := make(chan struct{}), make(chan struct{})
+		defer func() {
+			close(stop)
+			<-done
+		}()
+
+		leaks, err := Scope(func() {
+			started := make(chan struct{})
+			Go("worker", func() {
+				defer close(done)
+				close(started)
+				<-stop
+			})
+			<-started
+		}, testOptions())
+		require.NoError(t, err)
+		assert.Empty(t, leaks)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := Scope(func() {}, RunOnFailure())
+		assert.Error(t, err)
+
+		_, err = Scope(func() {}, Cleanup(func(int) {}))
+		assert.Error(t, err)
+	})
+}
+
+func TestCheckParentIDs(t *testing.T) {
+	all := stack.All()
+	if !hasParentIDs() {
+		assert.Error(t, checkParentIDs(all), "parent IDs are not available before Go 1.21")
+		return
+	}
+	assert.NoError(t, checkParentIDs(all))
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"sort"
+	"strings"
+
+	"go.uber.org/goleak/internal/stack"
+)
+
+// Snapshot is the set of goroutines that were running
+// at the time it was taken.
+type Snapshot struct {
+	stacks map[int]stack.Stack // by goroutine ID
+}
+
+// Take takes a snapshot of all running goroutines,
+// including the calling goroutine.
+func Take() Snapshot {
+	all := stack.All()
+	stacks := make(map[int]stack.Stack, len(all))
+	for _, s := range all {
+		stacks[s.ID()] = s
+	}
+	return Snapshot{stacks: stacks}
+}
+
+// Goroutines returns the goroutines in the snapshot, sorted by ID.
+func (s Snapshot) Goroutines() []Goroutine {
+	gs := make([]Goroutine, 0, len(s.stacks))
+	for _, st := range s.stacks {
+		gs = append(gs, Goroutine{s: st})
+	}
+	sortGoroutines(gs)
+	return gs
+}
+
+// Contains reports whether the goroutine with the given ID
+// was running when the snapshot was taken.
+func (s Snapshot) Contains(id int) bool {
+	_, ok := s.stacks[id]
+	return ok
+}
+
+// SnapshotDiff is the difference between two snapshots.
+// All lists are sorted by goroutine ID.
+type SnapshotDiff struct {
+	// Added holds goroutines that are only in the later snapshot.
+	Added []Goroutine
+
+	// Removed holds goroutines that are only in the earlier snapshot.
+	Removed []Goroutine
+
+	// Changed holds goroutines that are in both snapshots,
+	// but with a different state or top function.
+	Changed []GoroutineChange
+}
+
+// GoroutineChange is a goroutine that changed between two snapshots.
+type GoroutineChange struct {
+	Before Goroutine
+	After  Goroutine
+}
+
+// Empty reports whether there are no differences.
+func (d SnapshotDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Diff reports the goroutines that were added, removed, or changed
+// in a later snapshot compared to this one.
+//
+// A goroutine changed if it has the same ID in both snapshots,
+// but a different state or function at the top of its stack.
+// Changes to only how long a goroutine has been blocked are ignored.
+func (s Snapshot) Diff(later Snapshot) SnapshotDiff {
+	var d SnapshotDiff
+	for id, before := range s.stacks {
+		after, ok := later.stacks[id]
+		if !ok {
+			d.Removed = append(d.Removed, Goroutine{s: before})
+			continue
+		}
+		if stateWithoutWait(before.State()) != stateWithoutWait(after.State()) ||
+			before.FirstFunction() != after.FirstFunction() {
+			d.Changed = append(d.Changed, GoroutineChange{
+				Before: Goroutine{s: before},
+				After:  Goroutine{s: after},
+			})
+		}
+	}
+	for id, after := range later.stacks {
+		if _, ok := s.stacks[id]; !ok {
+			d.Added = append(d.Added, Goroutine{s: after})
+		}
+	}
+
+	sortGoroutines(d.Added)
+	sortGoroutines(d.Removed)
+	sort.Slice(d.Changed, func(i, j int) bool {
+		return d.Changed[i].Before.ID() < d.Changed[j].Before.ID()
+	})
+	return d
+}
+
+func sortGoroutines(gs []Goroutine) {
+	sort.Slice(gs, func(i, j int) bool {
+		return gs[i].ID() < gs[j].ID()
+	})
+}
+
+// stateWithoutWait strips how long a goroutine has been blocked
+// from its state. For example, "chan receive, 5 minutes" becomes
+// "chan receive".
+func stateWithoutWait(state string) string {
+	parts := strings.Split(state, ", ")
+	kept := parts[:0]
+	for _, p := range parts {
+		if !strings.HasSuffix(p, " minutes") {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, ", ")
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/internal/stack"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	byID := func(id int) Matcher {
+		return func(g Goroutine) bool { return g.ID() == id }
+	}
+
+	bgRemoved := startBlockedG()
+	bgKept := startBlockedG()
+	defer bgKept.unblock()
+
+	// A goroutine that changes state between snapshots.
+	step := make(chan struct{})
+	stepper := make(chan int, 1)
+	go func() {
+		stepper <- stack.Current().ID()
+		step <- struct{}{}
+		<-step
+	}()
+	stepperID := <-stepper
+	defer close(step)
+	_, err := WaitFor(ctx, func(g Goroutine) bool {
+		return g.ID() == stepperID && g.State() == "chan send"
+	})
+	require.NoError(t, err)
+
+	before := Take()
+	assert.True(t, before.Contains(bgRemoved.id))
+	assert.True(t, before.Contains(bgKept.id))
+
+	bgRemoved.unblock()
+	require.NoError(t, WaitGone(ctx, byID(bgRemoved.id)))
+	bgAdded := startBlockedG()
+	defer bgAdded.unblock()
+	<-step
+	_, err = WaitFor(ctx, func(g Goroutine) bool {
+		return g.ID() == stepperID && g.State() == "chan receive"
+	})
+	require.NoError(t, err)
+
+	after := Take()
+	diff := before.Diff(after)
+	assert.False(t, diff.Empty())
+
+	require.Len(t, diff.Added, 1)
+	assert.Equal(t, bgAdded.id, diff.Added[0].ID())
+
+	require.Len(t, diff.Removed, 1)
+	assert.Equal(t, bgRemoved.id, diff.Removed[0].ID())
+
+	require.Len(t, diff.Changed, 1)
+	assert.Equal(t, stepperID, diff.Changed[0].Before.ID())
+	assert.Equal(t, "chan send", diff.Changed[0].Before.State())
+	assert.Equal(t, "chan receive", diff.Changed[0].After.State())
+
+	assert.True(t, after.Diff(after).Empty(), "Snapshot should not differ from itself")
+	assert.Len(t, after.Goroutines(), len(after.stacks))
+}
+
+func TestStateWithoutWait(t *testing.T) {
+	tests := []struct {
+		give string
+		want string
+	}{
+		{"running", "running"},
+		{"chan receive", "chan receive"},
+		{"chan receive, 5 minutes", "chan receive"},
+		{"select, 2 minutes, locked to thread", "select, locked to thread"},
+		{"syscall, locked to thread", "syscall, locked to thread"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.give, func(t *testing.T) {
+			assert.Equal(t, tt.want, stateWithoutWait(tt.give))
+		})
+	}
+}
+
+func TestIgnoreSnapshot(t *testing.T) {
+	bg := startBlockedG()
+	snap := Take()
+	bg2 := startBlockedG()
+
+	err := Find(testOptions(), IgnoreSnapshot(snap))
+	require.Error(t, err)
+
+	bg2.unblock()
+	assert.NoError(t, Find(IgnoreSnapshot(snap)))
+	bg.unblock()
+}
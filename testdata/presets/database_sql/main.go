@@ -0,0 +1,35 @@
+// This program prints the stacks of a program with an open sql.DB,
+// for the "database/sql" preset.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"go.uber.org/goleak/testdata/presets/internal/stacks"
+)
+
+func main() {
+	db := sql.OpenDB(connector{})
+	if err := db.Ping(); err != nil {
+		panic(err)
+	}
+	// Starts the connection cleaner.
+	db.SetConnMaxLifetime(time.Hour)
+
+	stacks.Print()
+}
+
+type connector struct{}
+
+func (connector) Connect(context.Context) (driver.Conn, error) { return conn{}, nil }
+func (connector) Driver() driver.Driver                        { return nil }
+
+type conn struct{}
+
+func (conn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (conn) Close() error                        { return nil }
+func (conn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
@@ -0,0 +1,18 @@
+// This program prints the stacks of a program that logs with glog,
+// for the "github.com/golang/glog" preset.
+package main
+
+import (
+	"flag"
+
+	"github.com/golang/glog"
+	"go.uber.org/goleak/testdata/presets/internal/stacks"
+)
+
+func main() {
+	flag.Set("log_dir", "/tmp")
+	flag.Parse()
+	glog.Info("hello")
+
+	stacks.Print()
+}
@@ -0,0 +1,21 @@
+// This program prints the stacks of a program that records
+// opencensus views, for the "go.opencensus.io" preset.
+package main
+
+import (
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.uber.org/goleak/testdata/presets/internal/stacks"
+)
+
+func main() {
+	requests := stats.Int64("requests", "Number of requests", stats.UnitDimensionless)
+	if err := view.Register(&view.View{
+		Measure:     requests,
+		Aggregation: view.Count(),
+	}); err != nil {
+		panic(err)
+	}
+
+	stacks.Print()
+}
@@ -0,0 +1,37 @@
+// This program prints the stacks of a program with a gRPC ClientConn
+// connected to a server, for the "google.golang.org/grpc" preset.
+package main
+
+import (
+	"context"
+	"net"
+
+	"go.uber.org/goleak/testdata/presets/internal/stacks"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func main() {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(ln)
+
+	conn, err := grpc.NewClient("dns:///"+ln.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		panic(err)
+	}
+	if _, err := healthpb.NewHealthClient(conn).Check(
+		context.Background(), &healthpb.HealthCheckRequest{},
+	); err != nil {
+		panic(err)
+	}
+
+	stacks.Print()
+}
@@ -0,0 +1,25 @@
+// Package stacks prints the stacks of all goroutines
+// for the programs that record the preset fixtures.
+package stacks
+
+import (
+	"os"
+	"runtime"
+	"time"
+)
+
+// Print waits for goroutines to block,
+// and prints the stacks of all goroutines to stdout.
+func Print() {
+	time.Sleep(100 * time.Millisecond)
+	os.Stdout.Write(getStackBuffer())
+}
+
+func getStackBuffer() []byte {
+	for i := 4096; ; i *= 2 {
+		buf := make([]byte, i)
+		if n := runtime.Stack(buf, true /* all */); n < i {
+			return buf[:n]
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// This program prints the stacks of a program with an http.Transport
+// that has an idle connection in its pool,
+// and a connection with a response body that was never closed,
+// for the "net/http" preset.
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+
+	"go.uber.org/goleak/testdata/presets/internal/stacks"
+)
+
+func main() {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	url := "http://" + ln.Addr().String()
+
+	busy, err := http.Get(url)
+	if err != nil {
+		panic(err)
+	}
+	_ = busy // the body is never closed
+
+	// The first connection is busy until its body is closed,
+	// so this request dials a second one.
+	res, err := http.Get(url)
+	if err != nil {
+		panic(err)
+	}
+	// Reading the body to the end returns the connection to the pool.
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	stacks.Print()
+}
@@ -49,6 +49,9 @@ type TestingM interface {
 //
 // This will run all tests as per normal, and if they were successful, look
 // for any goroutine leaks and fail the tests if any leaks were found.
+//
+// Setting the GOLEAK_DISABLE environment variable to true
+// skips the check, as it does for Find and VerifyNone.
 func VerifyTestMain(m TestingM, options ...Option) {
 	exitCode := m.Run()
 	opts := buildOpts(options...)
@@ -60,15 +63,29 @@ func VerifyTestMain(m TestingM, options ...Option) {
 	}
 	defer func() { cleanup(exitCode) }()
 
+	runOnFailure, ok, err := lookupBoolEnv(_runOnFailureEnv)
+	if err != nil {
+		fmt.Fprintf(_osStderr, "%v\n", err)
+		if exitCode == 0 {
+			exitCode = 1
+		}
+		return
+	}
+	if !ok {
+		runOnFailure = opts.runOnFailure
+	}
+	// Find doesn't accept RunOnFailure, so don't pass it on.
+	opts.runOnFailure = false
+
 	var (
 		run      bool
 		errorMsg string
 	)
 
-	if !opts.runOnFailure && exitCode == 0 {
+	if !runOnFailure && exitCode == 0 {
 		errorMsg = "goleak: Errors on successful test run:%v\n"
 		run = true
-	} else if opts.runOnFailure {
+	} else if runOnFailure {
 		errorMsg = "goleak: Errors on unsuccessful test run: %v\n"
 		run = true
 	}
@@ -69,7 +69,9 @@ func TestVerifyTestMain(t *testing.T) {
 
 	VerifyTestMain(dummyTestMain(7), RunOnFailure())
 	assert.Equal(t, 7, <-exitCode, "Exit code should not be modified")
-	assert.Contains(t, <-stderr, "goleak: Errors", "Find leaks on unsuccessful runs with RunOnFailure specified")
+	out := <-stderr
+	assert.Contains(t, out, "goleak: Errors", "Find leaks on unsuccessful runs with RunOnFailure specified")
+	assert.Contains(t, out, "blockedG", "Report the leaks on unsuccessful runs with RunOnFailure specified")
 
 	VerifyTestMain(dummyTestMain(0))
 	assert.Equal(t, 1, <-exitCode, "Expect error due to leaks on successful runs")
@@ -89,3 +91,64 @@ func TestVerifyTestMain(t *testing.T) {
 	assert.True(t, cleanupCalled)
 	assert.Equal(t, 3, cleanupExitcode)
 }
+
+func TestVerifyTestMainWarnOnly(t *testing.T) {
+	defer clearOSStubs()
+	exitCode, stderr := osStubs()
+
+	blocked := startBlockedG()
+	defer blocked.unblock()
+
+	VerifyTestMain(dummyTestMain(0), WarnOnly())
+	assert.Equal(t, 0, <-exitCode, "Exit code should not be modified in warn-only mode")
+	out := <-stderr
+	assert.Contains(t, out, "goleak: found 1 unexpected goroutines")
+	assert.NotContains(t, out, "goleak: Errors")
+}
+
+func TestVerifyTestMainHooks(t *testing.T) {
+	defer clearOSStubs()
+	exitCode, stderr := osStubs()
+
+	var calls []string
+	hooks := []Option{
+		BeforeCheck(func() { calls = append(calls, "before") }),
+		OnLeak(func([]Goroutine) { calls = append(calls, "leak") }),
+		AfterCheck(func(error) { calls = append(calls, "after") }),
+	}
+
+	blocked := startBlockedG()
+	VerifyTestMain(dummyTestMain(0), hooks...)
+	assert.Equal(t, 1, <-exitCode, "Expect error due to leaks on successful runs")
+	assert.Contains(t, <-stderr, "goleak: Errors", "Find leaks on successful runs")
+	assert.Equal(t, []string{"before", "leak", "after"}, calls)
+
+	calls = nil
+	VerifyTestMain(dummyTestMain(1), hooks...)
+	assert.Equal(t, 1, <-exitCode)
+	<-stderr
+	assert.Empty(t, calls, "Hooks should not run if the check doesn't")
+
+	blocked.unblock()
+	VerifyTestMain(dummyTestMain(0), hooks...)
+	assert.Equal(t, 0, <-exitCode, "Expect no errors without leaks")
+	<-stderr
+	assert.Equal(t, []string{"before", "after"}, calls)
+}
+
+func TestVerifyTestMainTrack(t *testing.T) {
+	defer clearOSStubs()
+	defer _readLabels.Store(false)
+	exitCode, stderr := osStubs()
+
+	var bg *blockedG
+	t.Run("leaky", func(t *testing.T) {
+		Track(t)
+		bg = startBlockedG()
+	})
+	defer bg.unblock()
+
+	VerifyTestMain(dummyTestMain(0))
+	assert.Equal(t, 1, <-exitCode, "Expect error due to leaks on successful runs")
+	assert.Contains(t, <-stderr, "started by TestVerifyTestMainTrack/leaky:")
+}
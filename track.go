@@ -0,0 +1,139 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"context"
+	"runtime/pprof"
+	"sync/atomic"
+
+	"go.uber.org/goleak/internal/stack"
+)
+
+// _testLabel is the profiler label that holds the name of the test
+// that started a goroutine.
+const _testLabel = "goleak.test"
+
+// _backgroundLabel is the profiler label that marks a goroutine
+// as an intentional background worker. It holds the worker's name.
+const _backgroundLabel = "goleak.background"
+
+// _readLabels is set once goroutines may have labels that goleak uses.
+// Reading labels is more expensive, so it's only done if needed.
+var _readLabels atomic.Bool
+
+// TrackedT is the minimal subset of testing.TB that Track uses.
+type TrackedT interface {
+	Name() string
+}
+
+type testCleaner interface {
+	Cleanup(func())
+}
+
+// Track attributes goroutines started by the calling test goroutine
+// from now on, and all goroutines that they start, to the given test.
+// Call it at the start of a test:
+//
+//	func TestFoo(t *testing.T) {
+//	  goleak.Track(t)
+//	  // ...
+//	}
+//
+// Leaks reported by [Find], [VerifyNone] and [VerifyTestMain]
+// are then grouped by the test that started them.
+// This is most useful with VerifyTestMain,
+// which otherwise cannot tell which test leaked a goroutine.
+//
+// Track sets a profiler label on the calling goroutine,
+// replacing any labels that it already has.
+// Goroutines inherit labels from the goroutine that starts them.
+// If t has a Cleanup method, the label is removed when the test ends.
+//
+// Labels are matched with goroutines by the functions on their stacks.
+// Goroutines with identical stacks that were started by different tests,
+// or by both a tracked and an untracked goroutine,
+// can't be told apart, so none of them are attributed to a test.
+func Track(t TrackedT) {
+	_readLabels.Store(true)
+	pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(),
+		pprof.Labels(_testLabel, t.Name())))
+
+	if c, ok := t.(testCleaner); ok {
+		c.Cleanup(func() {
+			pprof.SetGoroutineLabels(context.Background())
+		})
+	}
+}
+
+// Go runs fn in a new goroutine that is marked as an intentional,
+// long-lived background worker with the given name.
+// Goroutines started by it are marked too.
+// goleak doesn't report them, except in the list of
+// background goroutines in the leak report with [Explain].
+//
+// Unlike ignoring the goroutine by its functions,
+// this keeps working when they're renamed or refactored.
+// See [MarkBackground] for how the goroutine is marked.
+//
+// Marks are matched with goroutines by their stacks, like in [Track].
+// A marked goroutine with the same stack as an unmarked goroutine
+// can't be told apart from it, so both are reported.
+func Go(name string, fn func()) {
+	go func() {
+		MarkBackground(context.Background(), name)
+		fn()
+	}()
+}
+
+// MarkBackground marks the calling goroutine, and goroutines it starts
+// from now on, as an intentional, long-lived background worker
+// with the given name, like [Go].
+// It returns ctx with the profiler label that marks them,
+// which can be passed to [pprof.SetGoroutineLabels]
+// to mark other goroutines.
+//
+// The label replaces any labels that the calling goroutine has,
+// other than those in ctx.
+func MarkBackground(ctx context.Context, name string) context.Context {
+	_readLabels.Store(true)
+	ctx = pprof.WithLabels(ctx, pprof.Labels(_backgroundLabel, name))
+	pprof.SetGoroutineLabels(ctx)
+	return ctx
+}
+
+// allStacks returns the stacks for all running goroutines,
+// with their profiler labels if goleak needs them.
+func allStacks() []stack.Stack {
+	if _readLabels.Load() {
+		return stack.AllWithLabels()
+	}
+	return stack.All()
+}
+
+// filterAllStacks is a variant of allStacks
+// that only returns stacks for which keep returns true.
+func filterAllStacks(keep func(stack.Stack) bool) []stack.Stack {
+	if _readLabels.Load() {
+		return stack.FilterWithLabels(keep)
+	}
+	return stack.Filter(keep)
+}
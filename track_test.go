@@ -0,0 +1,238 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"context"
+	"errors"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/internal/stack"
+)
+
+func TestTrack(t *testing.T) {
+	defer _readLabels.Store(false)
+
+	var leaked *blockedG
+	t.Run("leaky", func(t *testing.T) {
+		Track(t)
+		leaked = startBlockedG()
+	})
+	defer leaked.unblock()
+
+	// Labels are matched to goroutines by their stacks,
+	// so the untracked goroutine must have a different stack
+	// to be told apart from the tracked one.
+	// See TestTrackIdenticalStacks.
+	var otherID int
+	stop, done := make(chan struct{}), make(chan struct{})
+	t.Run("untracked", func(t *testing.T) {
+		started := make(chan struct{})
+		go func() {
+			defer close(done)
+			otherID = stack.Current().ID()
+			close(started)
+			<-stop
+		}()
+		<-started
+	})
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	var leaks []Goroutine
+	err := Find(testOptions(), OnLeak(func(gs []Goroutine) {
+		leaks = gs
+	}))
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "started by TestTrack/leaky:")
+	assert.ErrorContains(t, err, "not attributed to a test:")
+
+	var lerr *leakError
+	require.True(t, errors.As(err, &lerr))
+	require.Len(t, lerr.stacks, 2)
+
+	tests := make(map[int]string)
+	for _, g := range leaks {
+		tests[g.ID()] = g.Test()
+	}
+	assert.Equal(t, map[int]string{
+		leaked.id: "TestTrack/leaky",
+		otherID:   "",
+	}, tests)
+}
+
+func TestTrackIdenticalStacks(t *testing.T) {
+	defer _readLabels.Store(false)
+
+	var leaked, other *blockedG
+	t.Run("leaky", func(t *testing.T) {
+		Track(t)
+		leaked = startBlockedG()
+	})
+	defer leaked.unblock()
+	t.Run("untracked", func(t *testing.T) {
+		other = startBlockedG()
+	})
+	defer other.unblock()
+
+	var leaks []Goroutine
+	err := Find(testOptions(), OnLeak(func(gs []Goroutine) {
+		leaks = gs
+	}))
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "started by",
+		"goroutines with identical stacks should not be attributed")
+
+	tests := make(map[int]string)
+	for _, g := range leaks {
+		tests[g.ID()] = g.Test()
+	}
+	assert.Equal(t, map[int]string{
+		leaked.id: "",
+		other.id:  "",
+	}, tests)
+}
+
+func TestTrackCleanup(t *testing.T) {
+	defer _readLabels.Store(false)
+
+	var bg *blockedG
+	t.Run("tracked", func(t *testing.T) {
+		// Cleanups run in reverse order,
+		// so this runs after the cleanup registered by Track.
+		t.Cleanup(func() {
+			bg = startBlockedG()
+		})
+		Track(t)
+	})
+	defer bg.unblock()
+
+	err := Find(testOptions())
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "started by", "label should be removed at the end of the test")
+}
+
+func TestGo(t *testing.T) {
+	defer _readLabels.Store(false)
+
+	stop := make(chan struct{})
+	done := make(chan struct{}, 2)
+	defer func() {
+		close(stop)
+		<-done
+		<-done
+	}()
+	started := make(chan struct{})
+	Go("worker", func() {
+		// Goroutines started by the worker are marked too.
+		go func() {
+			close(started)
+			<-stop
+			done <- struct{}{}
+		}()
+		<-stop
+		done <- struct{}{}
+	})
+	<-started
+
+	require.NoError(t, Find(testOptions()))
+
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	var leaks []Goroutine
+	err := Find(testOptions(), OnLeak(func(gs []Goroutine) {
+		leaks = gs
+	}))
+	require.Error(t, err)
+	require.Len(t, leaks, 1)
+	assert.Equal(t, bg.id, leaks[0].ID())
+	assert.NotContains(t, err.Error(), "background goroutines", "requires Explain")
+
+	err = Find(testOptions(), Explain())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "background goroutines:\n")
+	assert.Equal(t, 2, strings.Count(err.Error(), ": worker\n"))
+}
+
+func TestBackgroundIdenticalStacks(t *testing.T) {
+	defer _readLabels.Store(false)
+
+	var marked *blockedG
+	started := make(chan struct{})
+	go func() {
+		defer close(started)
+		MarkBackground(context.Background(), "worker")
+		marked = startBlockedG()
+	}()
+	<-started
+	defer marked.unblock()
+
+	unmarked := startBlockedG()
+	defer unmarked.unblock()
+
+	var leaks []Goroutine
+	err := Find(testOptions(), Explain(), OnLeak(func(gs []Goroutine) {
+		leaks = gs
+	}))
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "background goroutines",
+		"goroutines with identical stacks should not be treated as background")
+
+	var ids []int
+	for _, g := range leaks {
+		ids = append(ids, g.ID())
+	}
+	assert.ElementsMatch(t, []int{marked.id, unmarked.id}, ids,
+		"both goroutines should be reported")
+}
+
+func TestMarkBackground(t *testing.T) {
+	defer _readLabels.Store(false)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	defer func() {
+		close(stop)
+		<-done
+	}()
+	marked := make(chan context.Context)
+	go func() {
+		defer close(done)
+		marked <- MarkBackground(context.Background(), "server")
+		<-stop
+	}()
+	ctx := <-marked
+
+	labels := make(map[string]string)
+	pprof.ForLabels(ctx, func(key, value string) bool {
+		labels[key] = value
+		return true
+	})
+	assert.Equal(t, map[string]string{_backgroundLabel: "server"}, labels)
+	assert.NoError(t, Find(testOptions()))
+}
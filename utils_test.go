@@ -29,14 +29,17 @@ import (
 )
 
 type blockedG struct {
+	id      int // goroutine ID
 	started chan struct{}
 	wait    chan struct{}
+	done    chan struct{}
 }
 
 func startBlockedG() *blockedG {
 	bg := &blockedG{
 		started: make(chan struct{}),
 		wait:    make(chan struct{}),
+		done:    make(chan struct{}),
 	}
 	go bg.run()
 	<-bg.started
@@ -44,6 +47,8 @@ func startBlockedG() *blockedG {
 }
 
 func (bg *blockedG) run() {
+	defer close(bg.done)
+	bg.id = stack.Current().ID()
 	close(bg.started)
 	bg.block()
 }
@@ -52,8 +57,11 @@ func (bg *blockedG) block() {
 	<-bg.wait
 }
 
+// unblock releases the goroutine and waits until it's about to exit,
+// so it does not show up as a runnable goroutine in later tests.
 func (bg *blockedG) unblock() {
 	close(bg.wait)
+	<-bg.done
 }
 
 func getStableAll(t *testing.T, cur stack.Stack) []stack.Stack {
@@ -0,0 +1,102 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/goleak/internal/stack"
+)
+
+// WaitFor blocks until at least one goroutine that matches m is running,
+// and returns all matching goroutines.
+// It samples goroutines with the same backoff as [Find]
+// until the context is done.
+//
+// Use this to synchronize tests on the start of a background goroutine
+// instead of sleeping or polling, e.g.,
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+//	defer cancel()
+//	_, err := goleak.WaitFor(ctx, goleak.TopFunction("example.com/foo.(*Worker).run"))
+//
+// If the context is done first, the returned error includes
+// the stacks of all goroutines that were running at that time.
+func WaitFor(ctx context.Context, m Matcher) ([]Goroutine, error) {
+	matched, err := waitUntil(ctx, m, func(matched int) bool {
+		return matched > 0
+	})
+	if err != nil {
+		return nil, fmt.Errorf("goleak: no matching goroutines started: %w", err)
+	}
+	return newGoroutines(matched), nil
+}
+
+// WaitGone blocks until no goroutines that match m are running.
+// It samples goroutines with the same backoff as [Find]
+// until the context is done.
+//
+// If the context is done first, the returned error includes
+// the stacks of all goroutines that were running at that time.
+func WaitGone(ctx context.Context, m Matcher) error {
+	_, err := waitUntil(ctx, m, func(matched int) bool {
+		return matched == 0
+	})
+	if err != nil {
+		return fmt.Errorf("goleak: matching goroutines did not exit: %w", err)
+	}
+	return nil
+}
+
+// waitUntil samples the goroutines, other than the calling goroutine,
+// until done reports true for the number of goroutines that match m.
+// It returns the matching goroutines from the last sample.
+func waitUntil(ctx context.Context, m Matcher, done func(matched int) bool) ([]stack.Stack, error) {
+	cur := stack.Current().ID()
+	// Only the backoff is needed: the matcher replaces all other options.
+	opts := &opts{maxSleep: _defaultMaxSleep}
+
+	for i := 0; ; i++ {
+		var all, matched []stack.Stack
+		for _, s := range stack.All() {
+			if s.ID() == cur {
+				continue
+			}
+			all = append(all, s)
+			if m(Goroutine{s: s}) {
+				matched = append(matched, s)
+			}
+		}
+		if done(len(matched)) {
+			return matched, nil
+		}
+
+		timer := time.NewTimer(opts.backoff(i))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w, running goroutines:\n%s", ctx.Err(), all)
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2023 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitFor(t *testing.T) {
+	blocked := TopFunction("go.uber.org/goleak.(*blockedG).block")
+
+	t.Run("already running", func(t *testing.T) {
+		bg := startBlockedG()
+		defer bg.unblock()
+
+		gs, err := WaitFor(context.Background(), blocked)
+		require.NoError(t, err)
+		require.Len(t, gs, 1)
+		assert.Equal(t, "go.uber.org/goleak.startBlockedG", gs[0].CreatedBy())
+	})
+
+	t.Run("waits for start", func(t *testing.T) {
+		bgs := make(chan *blockedG, 1)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			bgs <- startBlockedG()
+		}()
+		defer func() { (<-bgs).unblock() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		gs, err := WaitFor(ctx, blocked)
+		require.NoError(t, err)
+		assert.Len(t, gs, 1)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := WaitFor(ctx, blocked)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ErrorContains(t, err, "no matching goroutines started")
+		assert.ErrorContains(t, err, "TestWaitFor", "error should include running goroutines")
+	})
+}
+
+func TestWaitGone(t *testing.T) {
+	blocked := TopFunction("go.uber.org/goleak.(*blockedG).block")
+
+	t.Run("not running", func(t *testing.T) {
+		require.NoError(t, WaitGone(context.Background(), blocked))
+	})
+
+	t.Run("waits for exit", func(t *testing.T) {
+		bg := startBlockedG()
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			bg.unblock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		require.NoError(t, WaitGone(ctx, blocked))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		bg := startBlockedG()
+		defer bg.unblock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := WaitGone(ctx, blocked)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ErrorContains(t, err, "matching goroutines did not exit")
+		assert.ErrorContains(t, err, "blockedG")
+	})
+}